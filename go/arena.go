@@ -0,0 +1,288 @@
+package lru
+
+import "sync"
+
+// string到[]byte的缓存，数据不含指针，GC不需要扫描
+type ArenaCache interface {
+	// create a cache with cap(capacity)
+	Create(cap int)
+
+	// add key and value, v is copied
+	Add(k string, v []byte)
+
+	// get the size of cache
+	Size() int
+
+	// find key, if find, move it to the tail, return a copy of the value
+	Find(k string) []byte
+
+	// remove a key, return its value
+	Remove(k string) []byte
+
+	// walk the entries, same order as Iterator(reverse), stop when fn returns false
+	// v is only valid inside fn
+	Range(reverse bool, fn func(k string, v []byte) bool) bool
+}
+
+// new a thread safe arena cache
+func NewArenaCache(cap int) ArenaCache {
+	c := &threadSafeArena{}
+	c.Create(cap)
+	return c
+}
+
+// new a thread unsafe arena cache
+func NewThreadUnsafeArenaCache(cap int) ArenaCache {
+	c := &arenaLRU{}
+	c.Create(cap)
+	return c
+}
+
+// 至少有这么多垃圾才压缩arena
+const minArenaGarbage = 4096
+
+/**
+节点
+没有指针，链表用下标表示，0是哨兵
+*/
+type arenaNode struct {
+	prev, next int32  // lru链表，空闲时next串成空闲链表
+	hnext      int32  // 同一个哈希桶的下一个节点
+	klen, vlen int32  // key和value的长度
+	off        int    // key在arena里的偏移，value紧跟在key后面
+	hash       uint64 // key的哈希
+}
+
+/**
+索引链接的lru缓存
+节点放在一个连续的slice里，key和value的字节放在一个[]byte里
+map的key是哈希值，value是桶里第一个节点的下标，所以map也不含指针
+整个缓存只有三个指针(三个slice/map的头)，GC的扫描和缓存大小无关
+arena只追加，删除和更新留下的垃圾超过一半时压缩
+*/
+type arenaLRU struct {
+	nodes   []arenaNode
+	dict    map[uint64]int32
+	arena   []byte
+	garbage int   // arena里已经没用的字节数
+	free    int32 // 空闲链表，0表示没有
+	len     int
+	cap     int
+}
+
+func (c *arenaLRU) Create(cap int) {
+	c.nodes = make([]arenaNode, cap+1)
+	c.dict = make(map[uint64]int32, cap)
+	c.arena = nil
+	c.garbage = 0
+	c.len = 0
+	c.cap = cap
+	// 哨兵自己连成环
+	c.nodes[0].prev, c.nodes[0].next = 0, 0
+	c.free = 0
+	for i := cap; i > 0; i-- {
+		c.nodes[i].next = c.free
+		c.free = int32(i)
+	}
+}
+
+func (c *arenaLRU) Add(k string, v []byte) {
+	if c.cap <= 0 {
+		return
+	}
+	h := fnvString(k)
+	i := c.find(k, h)
+	if i != 0 {
+		n := &c.nodes[i]
+		c.garbage += int(n.klen + n.vlen)
+		c.unlink(i)
+	} else {
+		if c.free == 0 {
+			c.evict()
+		}
+		i = c.free
+		c.free = c.nodes[i].next
+		n := &c.nodes[i]
+		n.hash = h
+		n.hnext = c.dict[h]
+		c.dict[h] = i
+		c.len++
+	}
+	n := &c.nodes[i]
+	n.off = len(c.arena)
+	n.klen, n.vlen = int32(len(k)), int32(len(v))
+	c.arena = append(c.arena, k...)
+	c.arena = append(c.arena, v...)
+	c.pushTail(i)
+	c.maybeCompact()
+}
+
+func (c *arenaLRU) Size() int {
+	return c.len
+}
+
+func (c *arenaLRU) Find(k string) []byte {
+	i := c.find(k, fnvString(k))
+	if i == 0 {
+		return nil
+	}
+	c.unlink(i)
+	c.pushTail(i)
+	return append([]byte{}, c.value(i)...)
+}
+
+func (c *arenaLRU) Remove(k string) []byte {
+	i := c.find(k, fnvString(k))
+	if i == 0 {
+		return nil
+	}
+	v := append([]byte{}, c.value(i)...)
+	c.delete(i)
+	return v
+}
+
+func (c *arenaLRU) Range(reverse bool, fn func(k string, v []byte) bool) bool {
+	if reverse {
+		for i := c.nodes[0].next; i != 0; i = c.nodes[i].next {
+			if !fn(c.key(i), c.value(i)) {
+				return false
+			}
+		}
+	} else {
+		for i := c.nodes[0].prev; i != 0; i = c.nodes[i].prev {
+			if !fn(c.key(i), c.value(i)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (c *arenaLRU) find(k string, h uint64) int32 {
+	for i := c.dict[h]; i != 0; i = c.nodes[i].hnext {
+		if c.nodes[i].hash == h && c.keyEquals(i, k) {
+			return i
+		}
+	}
+	return 0
+}
+
+// 淘汰最旧的
+func (c *arenaLRU) evict() {
+	c.delete(c.nodes[0].next)
+}
+
+// 从链表和哈希桶里删除，放回空闲链表
+func (c *arenaLRU) delete(i int32) {
+	n := &c.nodes[i]
+	c.garbage += int(n.klen + n.vlen)
+	c.unlink(i)
+	if c.dict[n.hash] == i {
+		if n.hnext == 0 {
+			delete(c.dict, n.hash)
+		} else {
+			c.dict[n.hash] = n.hnext
+		}
+	} else {
+		p := c.dict[n.hash]
+		for c.nodes[p].hnext != i {
+			p = c.nodes[p].hnext
+		}
+		c.nodes[p].hnext = n.hnext
+	}
+	n.hnext = 0
+	n.next = c.free
+	c.free = i
+	c.len--
+}
+
+func (c *arenaLRU) unlink(i int32) {
+	n := &c.nodes[i]
+	c.nodes[n.prev].next = n.next
+	c.nodes[n.next].prev = n.prev
+}
+
+func (c *arenaLRU) pushTail(i int32) {
+	last := c.nodes[0].prev
+	c.nodes[i].prev = last
+	c.nodes[i].next = 0
+	c.nodes[last].next = i
+	c.nodes[0].prev = i
+}
+
+// 垃圾超过一半时按链表顺序把活着的数据拷贝到新的arena
+func (c *arenaLRU) maybeCompact() {
+	if c.garbage < minArenaGarbage || c.garbage < len(c.arena)/2 {
+		return
+	}
+	arena := make([]byte, 0, len(c.arena)-c.garbage)
+	for i := c.nodes[0].next; i != 0; i = c.nodes[i].next {
+		n := &c.nodes[i]
+		end := n.off + int(n.klen+n.vlen)
+		off := len(arena)
+		arena = append(arena, c.arena[n.off:end]...)
+		n.off = off
+	}
+	c.arena = arena
+	c.garbage = 0
+}
+
+func (c *arenaLRU) key(i int32) string {
+	n := &c.nodes[i]
+	return string(c.arena[n.off : n.off+int(n.klen)])
+}
+
+// 比较时不分配内存
+func (c *arenaLRU) keyEquals(i int32, k string) bool {
+	n := &c.nodes[i]
+	return string(c.arena[n.off:n.off+int(n.klen)]) == k
+}
+
+func (c *arenaLRU) value(i int32) []byte {
+	n := &c.nodes[i]
+	start := n.off + int(n.klen)
+	return c.arena[start : start+int(n.vlen) : start+int(n.vlen)]
+}
+
+// 线程安全的arena缓存
+type threadSafeArena struct {
+	c arenaLRU
+	sync.Mutex
+}
+
+func (cache *threadSafeArena) Create(cap int) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.c.Create(cap)
+}
+
+func (cache *threadSafeArena) Add(k string, v []byte) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.c.Add(k, v)
+}
+
+func (cache *threadSafeArena) Size() int {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Size()
+}
+
+func (cache *threadSafeArena) Find(k string) []byte {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Find(k)
+}
+
+func (cache *threadSafeArena) Remove(k string) []byte {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Remove(k)
+}
+
+// the lock is held while walking, fn must not call the cache
+func (cache *threadSafeArena) Range(reverse bool, fn func(k string, v []byte) bool) bool {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Range(reverse, fn)
+}
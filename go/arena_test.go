@@ -0,0 +1,98 @@
+package lru
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func arenaKeys(c ArenaCache, reverse bool) string {
+	var keys []string
+	c.Range(reverse, func(k string, v []byte) bool {
+		keys = append(keys, k+"="+string(v))
+		return true
+	})
+	return fmt.Sprint(keys)
+}
+
+func TestArenaCache(t *testing.T) {
+	for _, c := range []ArenaCache{NewArenaCache(3), NewThreadUnsafeArenaCache(3)} {
+		Assert(c.Find("a") == nil, t)
+		c.Add("a", []byte("1"))
+		c.Add("b", []byte("2"))
+		c.Add("c", []byte("3"))
+		Assert(string(c.Find("a")) == "1", t)
+		c.Add("d", []byte("4")) // evicts b
+		Assert(c.Find("b") == nil, t)
+		Assert(c.Size() == 3, t)
+		Assert(arenaKeys(c, true) == "[c=3 a=1 d=4]", t)
+		Assert(arenaKeys(c, false) == "[d=4 a=1 c=3]", t)
+
+		c.Add("c", []byte("33"))
+		Assert(arenaKeys(c, false) == "[c=33 d=4 a=1]", t)
+		Assert(string(c.Remove("a")) == "1", t)
+		Assert(c.Remove("a") == nil, t)
+		Assert(c.Size() == 2, t)
+
+		// empty keys and values are fine
+		c.Add("", nil)
+		Assert(c.Find("") != nil && len(c.Find("")) == 0, t)
+
+		n := 0
+		Assert(!c.Range(false, func(k string, v []byte) bool { n++; return false }), t)
+		Assert(n == 1, t)
+
+		c.Create(1)
+		Assert(c.Size() == 0, t)
+		c.Add("x", []byte("y"))
+		c.Add("z", []byte("w"))
+		Assert(arenaKeys(c, true) == "[z=w]", t)
+	}
+}
+
+// the returned value is a copy, later writes do not change it
+func TestArenaCache_Copy(t *testing.T) {
+	c := NewThreadUnsafeArenaCache(2)
+	v := []byte("abc")
+	c.Add("k", v)
+	v[0] = 'x'
+	got := c.Find("k")
+	Assert(string(got) == "abc", t)
+	got[0] = 'y'
+	Assert(string(c.Find("k")) == "abc", t)
+}
+
+// compare against the pointer based lru under random churn, including compaction
+func TestArenaCache_Random(t *testing.T) {
+	const n = 200
+	a := NewThreadUnsafeArenaCache(n)
+	ref := NewThreadUnsafeLRUCache(n)
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100000; i++ {
+		k := strconv.Itoa(r.Intn(3 * n))
+		switch r.Intn(4) {
+		case 0:
+			Assert((a.Remove(k) == nil) == (ref.Remove(k) == nil), t)
+		case 1:
+			v, _ := ref.Find(k).(string)
+			got := a.Find(k)
+			Assert(string(got) == v && (got == nil) == (v == ""), t)
+		default:
+			v := k + ":" + strconv.Itoa(i)
+			a.Add(k, []byte(v))
+			ref.Add(k, v)
+		}
+	}
+	Assert(a.Size() == ref.Size(), t)
+	var keys []string
+	for p := range ref.Iter(false) {
+		keys = append(keys, p.k.(string)+"="+p.v.(string))
+	}
+	Assert(arenaKeys(a, false) == fmt.Sprint(keys), t)
+
+	// the arena never holds much more than the live data
+	live := 0
+	a.Range(true, func(k string, v []byte) bool { live += len(k) + len(v); return true })
+	Assert(len(a.(*arenaLRU).arena) <= 2*live+minArenaGarbage, t)
+}
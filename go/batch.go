@@ -0,0 +1,87 @@
+package lru
+
+/**
+批量操作
+一批操作只拿一次锁，顺序和输入一样，所以最后的新旧顺序是确定的
+*/
+
+func (cache *threadUnsafeLRU) AddAll(entries []Entry) {
+	for _, e := range entries {
+		cache.Add(e.Key, e.Value)
+	}
+}
+
+func (cache *threadUnsafeLRU) FindAll(keys []interface{}) []interface{} {
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		values[i] = cache.Find(k)
+	}
+	return values
+}
+
+func (cache *threadUnsafeLRU) RemoveAll(keys []interface{}) []interface{} {
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		values[i] = cache.Remove(k)
+	}
+	return values
+}
+
+func (cache *threadSafeLRU) AddAll(entries []Entry) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.c.AddAll(entries)
+}
+
+func (cache *threadSafeLRU) FindAll(keys []interface{}) []interface{} {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.FindAll(keys)
+}
+
+func (cache *threadSafeLRU) RemoveAll(keys []interface{}) []interface{} {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.RemoveAll(keys)
+}
+
+func (cache *concurrentLRU) AddAll(entries []Entry) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.drain()
+	for _, e := range entries {
+		cache.add(e.Key, e.Value)
+	}
+}
+
+/**
+和Find不一样，这里拿维护锁直接移动node，不走读缓冲
+读缓冲的重放顺序和输入顺序无关，走读缓冲的话新旧顺序就不确定了
+*/
+func (cache *concurrentLRU) FindAll(keys []interface{}) []interface{} {
+	values := make([]interface{}, len(keys))
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.drain()
+	for i, k := range keys {
+		p, ok := cache.data.Load(k)
+		if !ok {
+			continue
+		}
+		node := p.(*ccNode)
+		cache.unlink(node)
+		cache.pushTail(node)
+		values[i] = *node.value.Load()
+	}
+	return values
+}
+
+func (cache *concurrentLRU) RemoveAll(keys []interface{}) []interface{} {
+	values := make([]interface{}, len(keys))
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for i, k := range keys {
+		values[i] = cache.remove(k)
+	}
+	return values
+}
@@ -0,0 +1,58 @@
+package lru
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	caches := []LRUCache{NewLRUCache(4), NewThreadUnsafeLRUCache(4), NewConcurrentLRUCache(4)}
+	for _, a := range caches {
+		b := a.(Batcher)
+		b.AddAll([]Entry{{1, "a"}, {2, "b"}, {3, "c"}, {4, "d"}, {5, "e"}, {2, "bb"}})
+		Assert(a.Size() == 4, t)
+		AssertPairList([]lruPair{{3, "c"}, {4, "d"}, {5, "e"}, {2, "bb"}}, iterPairs(a), t)
+
+		got := b.FindAll([]interface{}{5, 1, 3, 2})
+		Assert(slices.Equal(got, []interface{}{"e", nil, "c", "bb"}), t)
+		// hits move to the tail in input order
+		AssertPairList([]lruPair{{4, "d"}, {5, "e"}, {3, "c"}, {2, "bb"}}, iterPairs(a), t)
+
+		got = b.RemoveAll([]interface{}{4, 9, 4, 3})
+		Assert(slices.Equal(got, []interface{}{"d", nil, nil, "c"}), t)
+		Assert(a.Size() == 2, t)
+		AssertPairList([]lruPair{{5, "e"}, {2, "bb"}}, iterPairs(a), t)
+
+		Assert(len(b.FindAll(nil)) == 0 && len(b.RemoveAll(nil)) == 0, t)
+		b.AddAll(nil)
+		Assert(a.Size() == 2, t)
+	}
+}
+
+// a batch is applied as a whole, other writers never interleave with it
+func TestBatch_Atomic(t *testing.T) {
+	for _, a := range []LRUCache{NewLRUCache(100), NewConcurrentLRUCache(100)} {
+		b := a.(Batcher)
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				entries := make([]Entry, 10)
+				for i := 0; i < 200; i++ {
+					for j := range entries {
+						entries[j] = Entry{j, g}
+					}
+					b.AddAll(entries)
+				}
+			}(g)
+		}
+		wg.Wait()
+		// all ten keys carry the value of the last batch
+		got := b.FindAll([]interface{}{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+		for _, v := range got {
+			Assert(v == got[0], t)
+		}
+	}
+}
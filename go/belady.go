@@ -0,0 +1,125 @@
+package lru
+
+import "container/heap"
+
+// 永远不会再被访问
+const neverUsed = int(^uint(0) >> 1)
+
+// 回放一个访问序列的结果
+type SimResult struct {
+	Hits   int // 命中次数
+	Misses int // 没命中次数
+}
+
+// hit ratio of the replay, 0 for an empty trace
+func (r SimResult) HitRatio() float64 {
+	total := r.Hits + r.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(r.Hits) / float64(total)
+}
+
+/**
+在cache上回放访问序列
+每个key先Find，没命中就Add
+trace: 访问序列
+return: 命中统计
+*/
+func Simulate(cache LRUCache, trace []interface{}) SimResult {
+	var r SimResult
+	for _, k := range trace {
+		if cache.Find(k) != nil {
+			r.Hits++
+			continue
+		}
+		r.Misses++
+		cache.Add(k, true)
+	}
+	return r
+}
+
+/**
+Belady 最优策略 (OPT / MIN)
+离线算法，需要完整的访问序列
+满了之后淘汰下一次访问最远的那个key
+结果是同样容量下任何策略命中率的上限，用来评估线上策略离最优有多远
+
+trace: 访问序列
+cap: 容量
+cost: O(n log cap)
+*/
+func SimulateBelady(trace []interface{}, cap int) SimResult {
+	var r SimResult
+	if cap <= 0 {
+		r.Misses = len(trace)
+		return r
+	}
+
+	// 从后往前扫描，算出每个位置的key下一次被访问的位置
+	next := make([]int, len(trace))
+	last := make(map[lruKey]int)
+	for i := len(trace) - 1; i >= 0; i-- {
+		if j, ok := last[trace[i]]; ok {
+			next[i] = j
+		} else {
+			next[i] = neverUsed
+		}
+		last[trace[i]] = i
+	}
+
+	dict := make(map[lruKey]*beladyNode)
+	h := make(beladyHeap, 0, cap)
+	for i, k := range trace {
+		if node, ok := dict[k]; ok {
+			r.Hits++
+			node.next = next[i]
+			heap.Fix(&h, node.index)
+			continue
+		}
+		r.Misses++
+		if len(h) >= cap {
+			// 淘汰下一次访问最远的
+			victim := heap.Pop(&h).(*beladyNode)
+			delete(dict, victim.key)
+		}
+		node := &beladyNode{key: k, next: next[i]}
+		heap.Push(&h, node)
+		dict[k] = node
+	}
+	return r
+}
+
+type beladyNode struct {
+	key   lruKey // 缓存的key
+	next  int    // 下一次被访问的位置
+	index int    // 在堆中的位置
+}
+
+// 最大堆，堆顶是下一次访问最远的node
+type beladyHeap []*beladyNode
+
+func (h beladyHeap) Len() int { return len(h) }
+
+func (h beladyHeap) Less(i, j int) bool { return h[i].next > h[j].next }
+
+func (h beladyHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *beladyHeap) Push(x interface{}) {
+	node := x.(*beladyNode)
+	node.index = len(*h)
+	*h = append(*h, node)
+}
+
+func (h *beladyHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	node := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return node
+}
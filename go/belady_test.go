@@ -0,0 +1,51 @@
+package lru
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func keys(ks ...int) []interface{} {
+	trace := make([]interface{}, len(ks))
+	for i, k := range ks {
+		trace[i] = k
+	}
+	return trace
+}
+
+func TestSimulateBelady(t *testing.T) {
+	// classic example: 3 frames, OPT has 9 misses
+	trace := keys(7, 0, 1, 2, 0, 3, 0, 4, 2, 3, 0, 3, 2, 1, 2, 0, 1, 7, 0, 1)
+	r := SimulateBelady(trace, 3)
+
+	Assert(r.Misses == 9, t)
+	Assert(r.Hits == 11, t)
+	Assert(r.HitRatio() == 11.0/20.0, t)
+}
+
+func TestSimulate_LRU(t *testing.T) {
+	// the same example with LRU has 12 misses
+	trace := keys(7, 0, 1, 2, 0, 3, 0, 4, 2, 3, 0, 3, 2, 1, 2, 0, 1, 7, 0, 1)
+	r := Simulate(NewThreadUnsafeLRUCache(3), trace)
+
+	Assert(r.Misses == 12, t)
+	Assert(r.Hits == 8, t)
+}
+
+func TestSimulateBelady_Bound(t *testing.T) {
+	trace := make([]interface{}, 10000)
+	for i := range trace {
+		trace[i] = int(rand.ExpFloat64() * 50)
+	}
+	for _, cap := range []int{1, 10, 50, 100} {
+		opt := SimulateBelady(trace, cap)
+		lru := Simulate(NewThreadUnsafeLRUCache(cap), trace)
+		Assert(opt.Hits+opt.Misses == len(trace), t)
+		Assert(opt.HitRatio() >= lru.HitRatio(), t)
+	}
+}
+
+func TestSimulateBelady_Empty(t *testing.T) {
+	Assert(SimulateBelady(nil, 10).HitRatio() == 0, t)
+	Assert(SimulateBelady(keys(1, 1), 0).Misses == 2, t)
+}
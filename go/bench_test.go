@@ -2,6 +2,9 @@ package lru
 
 import (
 	"math/rand"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
 	"testing"
 )
 
@@ -261,3 +264,182 @@ func BenchmarkThreadUnsafeLRU_Iter2(b *testing.B) {
 	a := makeThreadUnsafeLRU(100)
 	benchIter(b, a)
 }
+
+// benchmark thread unsafe sampled lru
+
+func BenchmarkThreadUnsafeSampledLRU_Add(b *testing.B) {
+	n := b.N / 2
+	if n == 0 {
+		n = 1
+	}
+	a := NewThreadUnsafeSampledLRUCache(n, 0)
+	benchAdd(b, a)
+}
+
+func BenchmarkThreadUnsafeSampledLRU_Add3(b *testing.B) {
+	a := NewThreadUnsafeSampledLRUCache(100, 0)
+	benchAdd(b, a)
+}
+
+func BenchmarkThreadUnsafeSampledLRU_Find3(b *testing.B) {
+	a := NewThreadUnsafeSampledLRUCache(100, 0)
+	for _, v := range nrand(100) {
+		a.Add(v, v)
+	}
+	benchFind(b, a)
+}
+
+// benchmark thread unsafe arena cache
+
+func BenchmarkThreadUnsafeArena_Add3(b *testing.B) {
+	a := NewThreadUnsafeArenaCache(100)
+	keys := make([]string, 1000)
+	for i := range keys {
+		keys[i] = strconv.Itoa(rand.Int())
+	}
+	v := make([]byte, 16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.Add(keys[i%len(keys)], v)
+	}
+}
+
+func BenchmarkThreadUnsafeArena_Find3(b *testing.B) {
+	a := NewThreadUnsafeArenaCache(100)
+	keys := make([]string, 100)
+	for i := range keys {
+		keys[i] = strconv.Itoa(rand.Int())
+		a.Add(keys[i], make([]byte, 16))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.Find(keys[i%len(keys)])
+	}
+}
+
+// gc cost of a big cache: ns/op is one full collection, scan-bytes the heap it had to scan
+
+const gcEntries = 1 << 20
+
+func benchGC(b *testing.B, keep interface{}) {
+	sample := []metrics.Sample{{Name: "/gc/scan/heap:bytes"}}
+	runtime.GC()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+	}
+	b.StopTimer()
+	metrics.Read(sample)
+	b.ReportMetric(float64(sample[0].Value.Uint64()), "scan-bytes")
+	runtime.KeepAlive(keep)
+}
+
+func BenchmarkGC_ThreadUnsafeLRU(b *testing.B) {
+	a := NewThreadUnsafeLRUCache(gcEntries)
+	for i := 0; i < gcEntries; i++ {
+		a.Add(strconv.Itoa(i), make([]byte, 16))
+	}
+	benchGC(b, a)
+}
+
+func BenchmarkGC_ThreadUnsafeArena(b *testing.B) {
+	a := NewThreadUnsafeArenaCache(gcEntries)
+	v := make([]byte, 16)
+	for i := 0; i < gcEntries; i++ {
+		a.Add(strconv.Itoa(i), v)
+	}
+	benchGC(b, a)
+}
+
+// steady state Add of pre-boxed keys: the evicted node is reused, 0 allocs/op
+
+func benchAddBoxed(b *testing.B, lru LRUCache) {
+	keys := make([]interface{}, 1000)
+	for i := range keys {
+		keys[i] = rand.Int()
+	}
+	for _, k := range keys {
+		lru.Add(k, k)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k := keys[i%len(keys)]
+		lru.Add(k, k)
+	}
+}
+
+func BenchmarkThreadSafeLRU_AddAllocs(b *testing.B) {
+	benchAddBoxed(b, NewLRUCache(100))
+}
+
+func BenchmarkThreadUnsafeLRU_AddAllocs(b *testing.B) {
+	benchAddBoxed(b, NewThreadUnsafeLRUCache(100))
+}
+
+// the same with the pool turned off, every Add allocates a node
+func BenchmarkThreadUnsafeLRU_AddAllocsNoPool(b *testing.B) {
+	a := NewThreadUnsafeLRUCache(100)
+	a.(Pooled).SetPoolSize(0)
+	benchAddBoxed(b, a)
+}
+
+// hot key reads from every core
+
+func benchFindParallel(b *testing.B, lru LRUCache) {
+	for i := 0; i < 1000; i++ {
+		lru.Add(i, i)
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.Int()
+		for pb.Next() {
+			lru.Find(i % 16)
+			i++
+		}
+	})
+}
+
+func BenchmarkThreadSafeLRU_FindParallel(b *testing.B) {
+	benchFindParallel(b, NewLRUCache(1000))
+}
+
+func BenchmarkConcurrentLRU_FindParallel(b *testing.B) {
+	benchFindParallel(b, NewConcurrentLRUCache(1000))
+}
+
+func BenchmarkConcurrentLRU_Add3(b *testing.B) {
+	a := NewConcurrentLRUCache(100)
+	benchAdd(b, a)
+}
+
+// 50 keys per request, one Find at a time vs one FindAll
+func benchFind50(b *testing.B, lru LRUCache, batch bool) {
+	for i := 0; i < 1000; i++ {
+		lru.Add(i, i)
+	}
+	keys := make([]interface{}, 50)
+	for i := range keys {
+		keys[i] = i * 7
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if batch {
+				lru.(Batcher).FindAll(keys)
+			} else {
+				for _, k := range keys {
+					lru.Find(k)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkThreadSafeLRU_Find50(b *testing.B) {
+	benchFind50(b, NewLRUCache(1000), false)
+}
+
+func BenchmarkThreadSafeLRU_FindAll50(b *testing.B) {
+	benchFind50(b, NewLRUCache(1000), true)
+}
@@ -0,0 +1,314 @@
+package lru
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	maxBusFrame    = 1 << 20
+	busDialTimeout = time.Second
+	busQueueSize   = 1024 // 每个peer最多排队的消息数
+)
+
+var (
+	errBusFrame = errors.New("lru: bad bus frame")
+
+	// a peer's send queue was full and the message was dropped
+	// the receiver sees a gap in the sequence numbers and purges
+	ErrBusDropped = errors.New("lru: bus queue full, message dropped")
+)
+
+/**
+基于tcp的总线
+每个节点监听一个地址，Publish时把消息交给本地的订阅者，再放进每个peer的发送队列
+每个peer有一个协程负责连接和发送，Publish不会因为连接或者写慢的peer阻塞
+队列满了或者连不上时消息直接丢掉，由序号检测出来
+帧格式: uvarint(len) | uvarint(len(source)) source | uvarint(seq) | purge(1 byte) | key
+*/
+type TCPBus struct {
+	subscribers
+
+	ln net.Listener
+	wg sync.WaitGroup
+
+	mu      sync.Mutex
+	peers   map[string]*busPeer
+	inbound map[net.Conn]struct{}
+	closed  bool
+}
+
+// 一个peer的发送队列，由send协程消费
+type busPeer struct {
+	addr   string
+	queue  chan []byte
+	ctx    context.Context // 取消时send协程退出，正在进行的连接和写入也会中断
+	cancel context.CancelFunc
+
+	mu   sync.Mutex
+	conn net.Conn
+	err  error // 上次Publish之后发送协程遇到的第一个错误
+}
+
+// listen on addr, like "127.0.0.1:0"
+func NewTCPBus(addr string) (*TCPBus, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	b := &TCPBus{
+		ln:      ln,
+		peers:   make(map[string]*busPeer),
+		inbound: make(map[net.Conn]struct{}),
+	}
+	b.wg.Add(1)
+	go b.accept()
+	return b, nil
+}
+
+// the address other buses should use as a peer
+func (b *TCPBus) Addr() string {
+	return b.ln.Addr().String()
+}
+
+// replace the peers messages are sent to, this bus's own address is skipped
+func (b *TCPBus) SetPeers(addrs ...string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	peers := make(map[string]*busPeer, len(addrs))
+	for _, addr := range addrs {
+		if addr == b.Addr() {
+			continue
+		}
+		p := b.peers[addr]
+		if p == nil {
+			p = &busPeer{addr: addr, queue: make(chan []byte, busQueueSize)}
+			p.ctx, p.cancel = context.WithCancel(context.Background())
+			b.wg.Add(1)
+			go b.send(p)
+		}
+		peers[addr] = p
+	}
+	for addr, p := range b.peers {
+		if _, ok := peers[addr]; !ok {
+			p.cancel()
+		}
+	}
+	b.peers = peers
+}
+
+/**
+发给本地订阅者，再放进所有peer的发送队列，不会阻塞
+返回第一个错误：队列满了丢掉的(ErrBusDropped)，或者发送协程上次Publish之后遇到的连接和写入错误
+*/
+func (b *TCPBus) Publish(msg Invalidation) error {
+	b.deliver(msg)
+	frame := encodeBusFrame(msg)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return net.ErrClosed
+	}
+	var first error
+	for _, p := range b.peers {
+		err := p.takeErr()
+		select {
+		case p.queue <- frame:
+		default:
+			err = ErrBusDropped
+		}
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (b *TCPBus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	err := b.ln.Close()
+	for _, p := range b.peers {
+		p.cancel()
+	}
+	for conn := range b.inbound {
+		conn.Close()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+	b.clear()
+	return err
+}
+
+func (b *TCPBus) accept() {
+	defer b.wg.Done()
+	for {
+		conn, err := b.ln.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			conn.Close()
+			return
+		}
+		b.inbound[conn] = struct{}{}
+		b.wg.Add(1)
+		b.mu.Unlock()
+		go b.read(conn)
+	}
+}
+
+/**
+一个peer的发送协程
+没有连接时先连，连不上就丢掉这条消息，等busDialTimeout之后再试，期间的消息也丢掉
+写失败就断开，下一条消息重连
+*/
+func (b *TCPBus) send(p *busPeer) {
+	defer b.wg.Done()
+	defer p.setConn(nil)
+	// 取消时关掉连接，打断正在进行的写
+	stop := context.AfterFunc(p.ctx, func() { p.setConn(nil) })
+	defer stop()
+	var retry time.Time // 连接失败之后，这个时间之前不再重连
+	dialer := net.Dialer{Timeout: busDialTimeout}
+	for {
+		var frame []byte
+		select {
+		case <-p.ctx.Done():
+			return
+		case frame = <-p.queue:
+		}
+		conn := p.getConn()
+		if conn == nil {
+			if time.Now().Before(retry) {
+				continue
+			}
+			c, err := dialer.DialContext(p.ctx, "tcp", p.addr)
+			if err != nil {
+				p.fail(err)
+				retry = time.Now().Add(busDialTimeout)
+				continue
+			}
+			conn = c
+			p.setConn(conn)
+		}
+		conn.SetWriteDeadline(time.Now().Add(busDialTimeout))
+		if _, err := conn.Write(frame); err != nil {
+			p.fail(err)
+			p.setConn(nil)
+		}
+	}
+}
+
+// 换掉连接，旧的关闭
+func (p *busPeer) setConn(conn net.Conn) {
+	p.mu.Lock()
+	old := p.conn
+	p.conn = conn
+	p.mu.Unlock()
+	if old != nil {
+		old.Close()
+	}
+}
+
+func (p *busPeer) getConn() net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.conn
+}
+
+func (p *busPeer) fail(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *busPeer) takeErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	err := p.err
+	p.err = nil
+	return err
+}
+
+// 读一个peer发来的消息，出错就断开，对方会重连
+func (b *TCPBus) read(conn net.Conn) {
+	defer b.wg.Done()
+	defer func() {
+		conn.Close()
+		b.mu.Lock()
+		delete(b.inbound, conn)
+		b.mu.Unlock()
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := readBusFrame(r)
+		if err != nil {
+			return
+		}
+		b.deliver(msg)
+	}
+}
+
+func encodeBusFrame(msg Invalidation) []byte {
+	payload := make([]byte, 0, 2*binary.MaxVarintLen64+len(msg.Source)+1+len(msg.Key))
+	payload = binary.AppendUvarint(payload, uint64(len(msg.Source)))
+	payload = append(payload, msg.Source...)
+	payload = binary.AppendUvarint(payload, msg.Seq)
+	if msg.Purge {
+		payload = append(payload, 1)
+	} else {
+		payload = append(payload, 0)
+	}
+	payload = append(payload, msg.Key...)
+
+	frame := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(payload)), uint64(len(payload)))
+	return append(frame, payload...)
+}
+
+func readBusFrame(r *bufio.Reader) (Invalidation, error) {
+	var msg Invalidation
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return msg, err
+	}
+	if n > maxBusFrame {
+		return msg, errBusFrame
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return msg, err
+	}
+	srcLen, i := binary.Uvarint(payload)
+	if i <= 0 || uint64(len(payload)-i) < srcLen {
+		return msg, errBusFrame
+	}
+	msg.Source = string(payload[i : i+int(srcLen)])
+	payload = payload[i+int(srcLen):]
+	seq, i := binary.Uvarint(payload)
+	if i <= 0 || len(payload) < i+1 {
+		return msg, errBusFrame
+	}
+	msg.Seq = seq
+	msg.Purge = payload[i] == 1
+	msg.Key = payload[i+1:]
+	return msg, nil
+}
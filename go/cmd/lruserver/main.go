@@ -0,0 +1,53 @@
+// lruserver exposes a thread safe lru cache over TCP using the Redis RESP
+// protocol or the memcached text protocol, so stock clients can talk to it.
+//
+//	lruserver -addr :6379 -cap 100000
+//	redis-cli SET k v EX 10
+//
+//	lruserver -protocol memcache -addr :11211
+//
+// RESP commands: GET, SET (EX/PX), DEL, EXISTS, DBSIZE, FLUSHALL, INFO, PING, QUIT.
+// memcached commands: get, gets, set, add, replace, cas, delete, touch, incr,
+// decr, stats, flush_all, version, quit.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func main() {
+	addr := flag.String("addr", ":6379", "listen address")
+	cap := flag.Int("cap", 100000, "max number of keys")
+	proto := flag.String("protocol", protoRESP, "wire protocol: resp or memcache")
+	flag.Parse()
+
+	if *proto != protoRESP && *proto != protoMemcache {
+		fmt.Fprintln(os.Stderr, "lruserver: unknown protocol", *proto)
+		os.Exit(2)
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "lruserver:", err)
+		os.Exit(1)
+	}
+	s := newServer(*cap, *proto)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sig
+		s.close()
+	}()
+
+	fmt.Fprintln(os.Stderr, "lruserver: listening on", ln.Addr())
+	if err := s.serve(ln); err != nil {
+		fmt.Fprintln(os.Stderr, "lruserver:", err)
+		os.Exit(1)
+	}
+}
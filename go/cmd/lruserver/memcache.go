@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memcached文本协议: https://github.com/memcached/memcached/blob/master/doc/protocol.txt
+
+const (
+	mcMaxKeyLen   = 250
+	mcMaxItemSize = 1 << 20           // 和memcached默认的item_size_max一样
+	mcRelativeMax = 60 * 60 * 24 * 30 // 不超过30天的exptime是相对时间
+	mcVersion     = "1.6.0-lruserver"
+)
+
+func (s *server) serveMemcache(r *bufio.Reader, w *bufio.Writer) {
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			if err == errProtocol {
+				w.WriteString("CLIENT_ERROR line too long\r\n")
+				w.Flush()
+			}
+			return
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) == 0 {
+			continue
+		}
+		quit := s.execMemcache(r, w, fields)
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+/**
+执行一条memcached命令
+存储命令的数据块也从r里读
+return: 是否关闭连接
+*/
+func (s *server) execMemcache(r *bufio.Reader, w *bufio.Writer, fields []string) bool {
+	s.commands.Add(1)
+	name, args := fields[0], fields[1:]
+	switch name {
+	case "get", "gets":
+		if len(args) == 0 {
+			w.WriteString("ERROR\r\n")
+			break
+		}
+		for _, k := range args {
+			e := s.get(k)
+			if e == nil {
+				continue
+			}
+			if name == "gets" {
+				fmt.Fprintf(w, "VALUE %s %d %d %d\r\n", k, e.flags, len(e.value), e.cas)
+			} else {
+				fmt.Fprintf(w, "VALUE %s %d %d\r\n", k, e.flags, len(e.value))
+			}
+			w.Write(e.value)
+			w.WriteString("\r\n")
+		}
+		w.WriteString("END\r\n")
+	case "set", "add", "replace", "cas":
+		return s.storeMemcache(r, w, name, args)
+	case "delete":
+		// 老的客户端会发delete key 0
+		if len(args) == 0 || len(args) > 3 {
+			w.WriteString("ERROR\r\n")
+			break
+		}
+		noreply := hasNoreply(args)
+		reply := "NOT_FOUND"
+		if s.remove(args[0]) {
+			reply = "DELETED"
+		}
+		if !noreply {
+			w.WriteString(reply + "\r\n")
+		}
+	case "touch":
+		if len(args) != 2 && len(args) != 3 {
+			w.WriteString("ERROR\r\n")
+			break
+		}
+		exptime, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+			break
+		}
+		reply := s.touch(args[0], mcExpire(exptime, time.Now()))
+		if !hasNoreply(args) {
+			w.WriteString(reply + "\r\n")
+		}
+	case "incr", "decr":
+		if len(args) != 2 && len(args) != 3 {
+			w.WriteString("ERROR\r\n")
+			break
+		}
+		delta, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			w.WriteString("CLIENT_ERROR invalid numeric delta argument\r\n")
+			break
+		}
+		reply := s.incr(args[0], delta, name == "incr")
+		if !hasNoreply(args) {
+			w.WriteString(reply + "\r\n")
+		}
+	case "flush_all":
+		if len(args) > 0 && args[0] != "noreply" {
+			delay, err := strconv.ParseInt(args[0], 10, 64)
+			if err != nil || delay < 0 {
+				w.WriteString("CLIENT_ERROR invalid exptime argument\r\n")
+				break
+			}
+			s.flushAfter(time.Duration(delay) * time.Second)
+		} else {
+			s.flushAfter(0)
+		}
+		if !hasNoreply(args) {
+			w.WriteString("OK\r\n")
+		}
+	case "stats":
+		if len(args) > 0 {
+			// 只支持通用统计
+			w.WriteString("END\r\n")
+			break
+		}
+		s.mcStats(w)
+	case "version":
+		w.WriteString("VERSION " + mcVersion + "\r\n")
+	case "verbosity":
+		if !hasNoreply(args) {
+			w.WriteString("OK\r\n")
+		}
+	case "quit":
+		return true
+	default:
+		w.WriteString("ERROR\r\n")
+	}
+	return false
+}
+
+/**
+set/add/replace <key> <flags> <exptime> <bytes> [noreply]
+cas <key> <flags> <exptime> <bytes> <cas unique> [noreply]
+命令行后面跟着<bytes>字节的数据块和\r\n
+*/
+func (s *server) storeMemcache(r *bufio.Reader, w *bufio.Writer, name string, args []string) bool {
+	want := 4
+	if name == "cas" {
+		want = 5
+	}
+	if len(args) != want && len(args) != want+1 {
+		w.WriteString("ERROR\r\n")
+		return false
+	}
+	size, err := strconv.Atoi(args[3])
+	if err != nil || size < 0 {
+		// 不知道数据块多长，没法继续读这个连接
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return true
+	}
+	noreply := hasNoreply(args)
+	if size > mcMaxItemSize {
+		if _, err := io.CopyN(io.Discard, r, int64(size)+2); err != nil {
+			return true
+		}
+		w.WriteString("SERVER_ERROR object too large for cache\r\n")
+		return false
+	}
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return true
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		w.WriteString("CLIENT_ERROR bad data chunk\r\n")
+		return true
+	}
+
+	key := args[0]
+	flags, err1 := strconv.ParseUint(args[1], 10, 32)
+	exptime, err2 := strconv.ParseInt(args[2], 10, 64)
+	var unique uint64
+	var err3 error
+	if name == "cas" {
+		unique, err3 = strconv.ParseUint(args[4], 10, 64)
+	}
+	if len(key) > mcMaxKeyLen || err1 != nil || err2 != nil || err3 != nil {
+		w.WriteString("CLIENT_ERROR bad command line format\r\n")
+		return false
+	}
+
+	e := &entry{
+		value:  data[:size],
+		expire: mcExpire(exptime, time.Now()),
+		flags:  uint32(flags),
+	}
+	reply := s.store(name, key, e, unique)
+	if !noreply {
+		w.WriteString(reply + "\r\n")
+	}
+	return false
+}
+
+// 存储命令，返回应答
+func (s *server) store(name, key string, e *entry, unique uint64) string {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+	s.sets.Add(1)
+	cur := s.lookupLocked(key)
+	switch name {
+	case "add":
+		if cur != nil {
+			return "NOT_STORED"
+		}
+	case "replace":
+		if cur == nil {
+			return "NOT_STORED"
+		}
+	case "cas":
+		if cur == nil {
+			return "NOT_FOUND"
+		}
+		if cur.cas != unique {
+			return "EXISTS"
+		}
+	}
+	e.cas = s.casSeq.Add(1)
+	s.cache.Add(key, e)
+	return "STORED"
+}
+
+// 只改过期时间，cas不变
+func (s *server) touch(key string, expire int64) string {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+	cur := s.lookupLocked(key)
+	if cur == nil {
+		return "NOT_FOUND"
+	}
+	// 其他连接可能正在读cur，换一个新的entry
+	e := *cur
+	e.expire = expire
+	s.cache.Add(key, &e)
+	return "TOUCHED"
+}
+
+/**
+incr/decr
+值必须是64位无符号整数的十进制表示
+incr溢出时回绕，decr最小减到0
+*/
+func (s *server) incr(key string, delta uint64, up bool) string {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+	cur := s.lookupLocked(key)
+	if cur == nil {
+		return "NOT_FOUND"
+	}
+	n, err := strconv.ParseUint(strings.TrimRight(string(cur.value), " "), 10, 64)
+	if err != nil {
+		return "CLIENT_ERROR cannot increment or decrement non-numeric value"
+	}
+	if up {
+		n += delta
+	} else if delta > n {
+		n = 0
+	} else {
+		n -= delta
+	}
+	e := *cur
+	e.value = []byte(strconv.FormatUint(n, 10))
+	e.cas = s.casSeq.Add(1)
+	s.cache.Add(key, &e)
+	return string(e.value)
+}
+
+// delay为0时立即清空，否则delay之后清空
+func (s *server) flushAfter(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+		s.flushTimer = nil
+	}
+	if delay <= 0 {
+		s.flush()
+		return
+	}
+	s.flushTimer = time.AfterFunc(delay, s.flush)
+}
+
+func (s *server) mcStats(w *bufio.Writer) {
+	stat := func(k string, v interface{}) {
+		fmt.Fprintf(w, "STAT %s %v\r\n", k, v)
+	}
+	now := time.Now()
+	hits, misses := s.hits.Load(), s.misses.Load()
+	stat("pid", os.Getpid())
+	stat("uptime", int64(now.Sub(s.start).Seconds()))
+	stat("time", now.Unix())
+	stat("version", mcVersion)
+	stat("curr_connections", s.clients.Load())
+	stat("cmd_get", hits+misses)
+	stat("cmd_set", s.sets.Load())
+	stat("get_hits", hits)
+	stat("get_misses", misses)
+	stat("curr_items", s.cache.Size())
+	stat("limit_maxitems", s.cap)
+	w.WriteString("END\r\n")
+}
+
+/**
+memcached的exptime转成entry的过期时间
+0不过期，负数立即过期，不超过30天是相对秒数，否则是unix时间戳
+*/
+func mcExpire(exptime int64, now time.Time) int64 {
+	switch {
+	case exptime == 0:
+		return 0
+	case exptime < 0:
+		return 1
+	case exptime <= mcRelativeMax:
+		return now.Add(time.Duration(exptime) * time.Second).UnixNano()
+	default:
+		return time.Unix(exptime, 0).UnixNano()
+	}
+}
+
+func hasNoreply(args []string) bool {
+	return len(args) > 0 && args[len(args)-1] == "noreply"
+}
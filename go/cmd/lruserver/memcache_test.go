@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a minimal memcached text client: sends raw lines, reads until a terminal reply
+type mcClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func startMemcache(t *testing.T, cap int) *mcClient {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(cap, protoMemcache)
+	go s.serve(ln)
+	t.Cleanup(s.close)
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &mcClient{conn, bufio.NewReader(conn)}
+}
+
+func (c *mcClient) line(t *testing.T) string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.TrimSuffix(line, "\r\n")
+}
+
+// send a request and read one reply line, or everything up to END for get/stats
+func (c *mcClient) do(t *testing.T, req string) string {
+	c.conn.Write([]byte(req))
+	first := c.line(t)
+	if !strings.HasPrefix(first, "VALUE ") && !strings.HasPrefix(first, "STAT ") {
+		return first
+	}
+	lines := []string{first}
+	for {
+		l := c.line(t)
+		lines = append(lines, l)
+		if l == "END" {
+			return strings.Join(lines, "|")
+		}
+	}
+}
+
+func TestMemcache_Commands(t *testing.T) {
+	c := startMemcache(t, 100)
+	check := func(want, req string) {
+		t.Helper()
+		if got := c.do(t, req); got != want {
+			t.Errorf("%q: got %q, want %q", req, got, want)
+		}
+	}
+
+	check("END", "get k\r\n")
+	check("STORED", "set k 5 0 5\r\nhello\r\n")
+	check("VALUE k 5 5|hello|END", "get k\r\n")
+	check("NOT_STORED", "add k 0 0 1\r\nx\r\n")
+	check("STORED", "add k2 0 0 2\r\nv2\r\n")
+	check("VALUE k 5 5|hello|VALUE k2 0 2|v2|END", "get k nope k2\r\n")
+	check("NOT_STORED", "replace nope 0 0 1\r\nx\r\n")
+	check("STORED", "replace k2 7 0 3\r\nnew\r\n")
+	check("VALUE k2 7 3|new|END", "get k2\r\n")
+	check("DELETED", "delete k2\r\n")
+	check("NOT_FOUND", "delete k2\r\n")
+	check("OK", "flush_all\r\n")
+	check("END", "get k\r\n")
+	check("ERROR", "nope\r\n")
+	check("VERSION "+mcVersion, "version\r\n")
+}
+
+func TestMemcache_Cas(t *testing.T) {
+	c := startMemcache(t, 100)
+
+	c.do(t, "set k 0 0 1\r\na\r\n")
+	got := c.do(t, "gets k\r\n")
+	fields := strings.Fields(strings.Split(got, "|")[0])
+	if len(fields) != 5 {
+		t.Fatalf("unexpected gets reply %q", got)
+	}
+	unique := fields[4]
+
+	if got := c.do(t, "cas k 0 0 1 "+unique+"\r\nb\r\n"); got != "STORED" {
+		t.Errorf("cas with current unique: %q", got)
+	}
+	// the unique changed with the last store
+	if got := c.do(t, "cas k 0 0 1 "+unique+"\r\nc\r\n"); got != "EXISTS" {
+		t.Errorf("cas with stale unique: %q", got)
+	}
+	if got := c.do(t, "cas nope 0 0 1 1\r\nc\r\n"); got != "NOT_FOUND" {
+		t.Errorf("cas on missing key: %q", got)
+	}
+	if got := c.do(t, "get k\r\n"); got != "VALUE k 0 1|b|END" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMemcache_IncrDecr(t *testing.T) {
+	c := startMemcache(t, 100)
+
+	c.do(t, "set n 3 0 2\r\n10\r\n")
+	for _, tc := range []struct{ req, want string }{
+		{"incr n 5\r\n", "15"},
+		{"decr n 20\r\n", "0"},
+		{"incr n 18446744073709551615\r\n", "18446744073709551615"},
+		{"incr n 2\r\n", "1"},
+		{"incr nope 1\r\n", "NOT_FOUND"},
+		{"incr n x\r\n", "CLIENT_ERROR invalid numeric delta argument"},
+	} {
+		if got := c.do(t, tc.req); got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.req, got, tc.want)
+		}
+	}
+	// flags survive incr
+	if got := c.do(t, "get n\r\n"); got != "VALUE n 3 1|1|END" {
+		t.Errorf("got %q", got)
+	}
+	c.do(t, "set s 0 0 3\r\nabc\r\n")
+	if got := c.do(t, "incr s 1\r\n"); got != "CLIENT_ERROR cannot increment or decrement non-numeric value" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMemcache_Expire(t *testing.T) {
+	c := startMemcache(t, 100)
+
+	c.do(t, "set k 0 1 1\r\nv\r\n")
+	c.do(t, "set gone 0 -1 1\r\nv\r\n")
+	c.do(t, "set abs 0 "+strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)+" 1\r\nv\r\n")
+	if got := c.do(t, "get gone\r\n"); got != "END" {
+		t.Errorf("negative exptime should expire immediately, got %q", got)
+	}
+	if got := c.do(t, "touch k 100\r\n"); got != "TOUCHED" {
+		t.Errorf("got %q", got)
+	}
+	if got := c.do(t, "touch nope 100\r\n"); got != "NOT_FOUND" {
+		t.Errorf("got %q", got)
+	}
+	c.do(t, "touch abs -1\r\n")
+	time.Sleep(1100 * time.Millisecond)
+	if got := c.do(t, "get k\r\n"); got != "VALUE k 0 1|v|END" {
+		t.Errorf("touched key should outlive its first exptime, got %q", got)
+	}
+	if got := c.do(t, "get abs\r\n"); got != "END" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMemcache_NoreplyAndStats(t *testing.T) {
+	c := startMemcache(t, 100)
+
+	// noreply commands produce no output, so the next reply belongs to get
+	c.conn.Write([]byte("set a 0 0 1 noreply\r\n1\r\nincr a 1 noreply\r\ndelete b noreply\r\n"))
+	if got := c.do(t, "get a b\r\n"); got != "VALUE a 0 1|2|END" {
+		t.Errorf("got %q", got)
+	}
+	stats := c.do(t, "stats\r\n")
+	for _, want := range []string{"STAT get_hits 1", "STAT get_misses 1", "STAT curr_items 1", "STAT cmd_set 1"} {
+		if !strings.Contains(stats, want) {
+			t.Errorf("stats %q missing %q", stats, want)
+		}
+	}
+}
+
+func TestMemcache_BadData(t *testing.T) {
+	c := startMemcache(t, 100)
+
+	if got := c.do(t, "set k 0 0 1\r\ntoolong\r\n"); got != "CLIENT_ERROR bad data chunk" {
+		t.Errorf("got %q", got)
+	}
+	// the connection is closed after a bad chunk
+	if _, err := c.r.ReadString('\n'); err == nil {
+		t.Error("expected connection to be closed")
+	}
+}
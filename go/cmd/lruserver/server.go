@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	lru "github.com/Ninlgde/lrucache/go"
+)
+
+/**
+缓存里存的值
+缓存本身没有过期时间，EX/PX和memcached exptime的过期时间放在这里，读的时候检查
+存进缓存后不再修改，要改就换一个新的entry
+*/
+type entry struct {
+	value  []byte
+	expire int64  // 过期时间(UnixNano)，0表示不过期
+	flags  uint32 // memcached的flags
+	cas    uint64 // memcached的cas唯一值
+}
+
+func (e *entry) expired(now int64) bool {
+	return e.expire != 0 && now >= e.expire
+}
+
+// 支持的协议
+const (
+	protoRESP     = "resp"
+	protoMemcache = "memcache"
+)
+
+/**
+缓存服务
+所有连接共享一个线程安全的缓存
+proto决定连接上说的是RESP还是memcached文本协议
+*/
+type server struct {
+	cache lru.LRUCache
+	cap   int
+	proto string
+	start time.Time
+
+	// 所有写入(SET、删除、清空和memcached的存储命令)串行执行
+	// memcached的add/replace/cas/incr需要先读再写，删除过期entry也要确认没有被新写入替换
+	storeMu sync.Mutex
+	casSeq  atomic.Uint64
+
+	hits     atomic.Int64
+	misses   atomic.Int64
+	commands atomic.Int64
+	clients  atomic.Int64
+	sets     atomic.Int64
+
+	mu         sync.Mutex
+	ln         net.Listener
+	conns      map[net.Conn]struct{}
+	closed     bool
+	flushTimer *time.Timer // flush_all <delay>
+	wg         sync.WaitGroup
+}
+
+func newServer(cap int, proto string) *server {
+	return &server{
+		cache: lru.NewLRUCache(cap),
+		cap:   cap,
+		proto: proto,
+		start: time.Now(),
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// 接受连接直到listener被关闭
+func (s *server) serve(ln net.Listener) error {
+	s.mu.Lock()
+	s.ln = ln
+	s.mu.Unlock()
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+// 关闭listener和所有连接
+func (s *server) close() {
+	s.mu.Lock()
+	s.closed = true
+	if s.ln != nil {
+		s.ln.Close()
+	}
+	if s.flushTimer != nil {
+		s.flushTimer.Stop()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+}
+
+func (s *server) handle(conn net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+	s.clients.Add(1)
+	defer s.clients.Add(-1)
+
+	r := bufio.NewReaderSize(conn, 64*1024)
+	w := bufio.NewWriter(conn)
+	if s.proto == protoMemcache {
+		s.serveMemcache(r, w)
+	} else {
+		s.serveRESP(r, w)
+	}
+}
+
+func (s *server) serveRESP(r *bufio.Reader, w *bufio.Writer) {
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			if err == errProtocol {
+				writeError(w, "ERR "+err.Error())
+				w.Flush()
+			}
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		quit := s.exec(w, args)
+		// 管道里还有命令时先不flush
+		if r.Buffered() == 0 || quit {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+		if quit {
+			return
+		}
+	}
+}
+
+/**
+执行一条命令
+return: 是否关闭连接
+*/
+func (s *server) exec(w *bufio.Writer, args [][]byte) bool {
+	s.commands.Add(1)
+	name := strings.ToUpper(string(args[0]))
+	args = args[1:]
+	switch name {
+	case "PING":
+		if len(args) > 0 {
+			writeBulk(w, args[0])
+		} else {
+			writeSimple(w, "PONG")
+		}
+	case "GET":
+		if len(args) != 1 {
+			return wrongArgs(w, name)
+		}
+		e := s.get(string(args[0]))
+		if e == nil {
+			writeBulk(w, nil)
+		} else {
+			writeBulk(w, e.value)
+		}
+	case "SET":
+		s.set(w, args)
+	case "DEL":
+		if len(args) == 0 {
+			return wrongArgs(w, name)
+		}
+		n := 0
+		for _, k := range args {
+			if s.remove(string(k)) {
+				n++
+			}
+		}
+		writeInt(w, n)
+	case "EXISTS":
+		if len(args) == 0 {
+			return wrongArgs(w, name)
+		}
+		n := 0
+		for _, k := range args {
+			if s.get(string(k)) != nil {
+				n++
+			}
+		}
+		writeInt(w, n)
+	case "DBSIZE":
+		writeInt(w, s.cache.Size())
+	case "FLUSHALL", "FLUSHDB":
+		s.flush()
+		writeSimple(w, "OK")
+	case "INFO":
+		writeBulk(w, s.info())
+	case "COMMAND":
+		// redis-cli启动时会发COMMAND DOCS
+		writeArrayHeader(w, 0)
+	case "QUIT":
+		writeSimple(w, "OK")
+		return true
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", name))
+	}
+	return false
+}
+
+// 查找并统计命中率
+func (s *server) get(k string) *entry {
+	e := s.lookup(k)
+	if e == nil {
+		s.misses.Add(1)
+	} else {
+		s.hits.Add(1)
+	}
+	return e
+}
+
+/**
+查找，过期的顺便删除
+没过期的不加锁，过期的在storeMu里重新查一次再删，避免删掉别的连接刚写入的值
+*/
+func (s *server) lookup(k string) *entry {
+	v := s.cache.Find(k)
+	if v == nil {
+		return nil
+	}
+	e := v.(*entry)
+	if !e.expired(time.Now().UnixNano()) {
+		return e
+	}
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+	return s.lookupLocked(k)
+}
+
+// 查找，过期的删除，调用者持有storeMu
+func (s *server) lookupLocked(k string) *entry {
+	v := s.cache.Find(k)
+	if v == nil {
+		return nil
+	}
+	e := v.(*entry)
+	if e.expired(time.Now().UnixNano()) {
+		s.cache.Remove(k)
+		return nil
+	}
+	return e
+}
+
+// 删除，return: 删掉的是没过期的entry
+func (s *server) remove(k string) bool {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+	v := s.cache.Remove(k)
+	return v != nil && !v.(*entry).expired(time.Now().UnixNano())
+}
+
+// 清空
+func (s *server) flush() {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+	s.cache.Create(s.cap)
+}
+
+// SET key value [EX seconds|PX milliseconds]
+func (s *server) set(w *bufio.Writer, args [][]byte) {
+	if len(args) != 2 && len(args) != 4 {
+		wrongArgs(w, "SET")
+		return
+	}
+	e := &entry{value: args[1]}
+	if len(args) == 4 {
+		n, err := strconv.ParseInt(string(args[3]), 10, 64)
+		if err != nil || n <= 0 {
+			writeError(w, "ERR invalid expire time in 'set' command")
+			return
+		}
+		var ttl time.Duration
+		switch strings.ToUpper(string(args[2])) {
+		case "EX":
+			ttl = time.Duration(n) * time.Second
+		case "PX":
+			ttl = time.Duration(n) * time.Millisecond
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+		e.expire = time.Now().Add(ttl).UnixNano()
+	}
+	s.storeMu.Lock()
+	s.cache.Add(string(args[0]), e)
+	s.storeMu.Unlock()
+	writeSimple(w, "OK")
+}
+
+func (s *server) info() []byte {
+	var b bytes.Buffer
+	line := func(k string, v interface{}) {
+		fmt.Fprintf(&b, "%s:%v\r\n", k, v)
+	}
+	b.WriteString("# Server\r\n")
+	line("redis_version", "7.0.0-lruserver")
+	line("uptime_in_seconds", int(time.Since(s.start).Seconds()))
+	b.WriteString("\r\n# Clients\r\n")
+	line("connected_clients", s.clients.Load())
+	b.WriteString("\r\n# Stats\r\n")
+	line("total_commands_processed", s.commands.Load())
+	line("keyspace_hits", s.hits.Load())
+	line("keyspace_misses", s.misses.Load())
+	b.WriteString("\r\n# Keyspace\r\n")
+	line("keys", s.cache.Size())
+	line("capacity", s.cap)
+	return b.Bytes()
+}
+
+func wrongArgs(w *bufio.Writer, name string) bool {
+	writeError(w, fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+	return false
+}
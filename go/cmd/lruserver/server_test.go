@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// a minimal RESP client
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func startServer(t *testing.T, cap int) (*server, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newServer(cap, protoRESP)
+	go s.serve(ln)
+	t.Cleanup(s.close)
+	return s, ln.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *client {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return &client{conn, bufio.NewReader(conn)}
+}
+
+func (c *client) send(args ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	c.conn.Write([]byte(b.String()))
+}
+
+// read one reply and render it as a string: +OK, :1, $nil, bulk, *n
+func (c *client) reply(t *testing.T) string {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	switch line[0] {
+	case '$':
+		if line == "$-1" {
+			return "$nil"
+		}
+		var n int
+		fmt.Sscanf(line[1:], "%d", &n)
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			t.Fatal(err)
+		}
+		return string(buf[:n])
+	}
+	return line
+}
+
+func (c *client) do(t *testing.T, args ...string) string {
+	c.send(args...)
+	return c.reply(t)
+}
+
+func TestServer_Commands(t *testing.T) {
+	_, addr := startServer(t, 100)
+	c := dial(t, addr)
+
+	check := func(want string, args ...string) {
+		t.Helper()
+		if got := c.do(t, args...); got != want {
+			t.Errorf("%v: got %q, want %q", args, got, want)
+		}
+	}
+
+	check("+PONG", "PING")
+	check("$nil", "GET", "k")
+	check("+OK", "SET", "k", "hello world")
+	check("hello world", "get", "k")
+	check(":1", "EXISTS", "k", "nope")
+	check("+OK", "SET", "k2", "v2")
+	check(":2", "DBSIZE")
+	check(":2", "DEL", "k", "k2", "k3")
+	check(":0", "DBSIZE")
+	check("+OK", "SET", "a", "1")
+	check("+OK", "FLUSHALL")
+	check(":0", "DBSIZE")
+	check("-ERR wrong number of arguments for 'get' command", "GET")
+	check("-ERR syntax error", "SET", "k", "v", "XX", "1")
+	check("-ERR unknown command 'NOPE'", "NOPE")
+}
+
+func TestServer_Expire(t *testing.T) {
+	_, addr := startServer(t, 100)
+	c := dial(t, addr)
+
+	if got := c.do(t, "SET", "k", "v", "PX", "50"); got != "+OK" {
+		t.Fatal(got)
+	}
+	if got := c.do(t, "SET", "long", "v", "EX", "100"); got != "+OK" {
+		t.Fatal(got)
+	}
+	if got := c.do(t, "GET", "k"); got != "v" {
+		t.Errorf("got %q before expiry", got)
+	}
+	time.Sleep(80 * time.Millisecond)
+	if got := c.do(t, "GET", "k"); got != "$nil" {
+		t.Errorf("got %q after expiry", got)
+	}
+	if got := c.do(t, "EXISTS", "long"); got != ":1" {
+		t.Errorf("got %q for long ttl", got)
+	}
+	if got := c.do(t, "SET", "k", "v", "EX", "0"); !strings.HasPrefix(got, "-ERR invalid expire") {
+		t.Errorf("got %q for bad ttl", got)
+	}
+}
+
+func TestServer_Eviction(t *testing.T) {
+	_, addr := startServer(t, 2)
+	c := dial(t, addr)
+
+	c.do(t, "SET", "a", "1")
+	c.do(t, "SET", "b", "2")
+	c.do(t, "GET", "a")
+	c.do(t, "SET", "c", "3") // evicts b
+	if got := c.do(t, "GET", "b"); got != "$nil" {
+		t.Errorf("b should be evicted, got %q", got)
+	}
+	if got := c.do(t, "GET", "a"); got != "1" {
+		t.Errorf("a should be kept, got %q", got)
+	}
+}
+
+func TestServer_PipelineAndInline(t *testing.T) {
+	_, addr := startServer(t, 100)
+	c := dial(t, addr)
+
+	// three commands in one write
+	c.conn.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\nx\r\n$1\r\n1\r\n*2\r\n$3\r\nGET\r\n$1\r\nx\r\nPING\r\n"))
+	for _, want := range []string{"+OK", "1", "+PONG"} {
+		if got := c.reply(t); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	if got := c.do(t, "INFO"); !strings.Contains(got, "keys:1") || !strings.Contains(got, "keyspace_hits:1") {
+		t.Errorf("unexpected INFO %q", got)
+	}
+	if got := c.do(t, "QUIT"); got != "+OK" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestServer_SharedAcrossClients(t *testing.T) {
+	_, addr := startServer(t, 100)
+	a := dial(t, addr)
+	b := dial(t, addr)
+
+	a.do(t, "SET", "shared", "yes")
+	if got := b.do(t, "GET", "shared"); got != "yes" {
+		t.Errorf("got %q", got)
+	}
+}
+
+// a SET landing between the expiry check and the delete survives
+func TestServer_ExpireRace(t *testing.T) {
+	s := newServer(10, protoRESP)
+	s.cache.Add("k", &entry{value: []byte("old"), expire: 1})
+
+	// the lookup sees the expired entry and waits for the store lock,
+	// meanwhile another client's SET replaces it
+	s.storeMu.Lock()
+	got := make(chan *entry)
+	go func() { got <- s.lookup("k") }()
+	time.Sleep(20 * time.Millisecond)
+	s.cache.Add("k", &entry{value: []byte("new")})
+	s.storeMu.Unlock()
+
+	e := <-got
+	if e == nil || string(e.value) != "new" {
+		t.Fatalf("got %v, want the new value", e)
+	}
+	if s.lookup("k") == nil {
+		t.Error("the new value was deleted")
+	}
+}
+
+// deletes and flushes wait for a read-modify-write (cas, incr) in progress,
+// so a key reported deleted is not written back afterwards
+func TestServer_DeleteWaitsForStore(t *testing.T) {
+	s := newServer(10, protoRESP)
+	s.cache.Add("k", &entry{value: []byte("1")})
+	for _, del := range []func(){
+		func() { s.remove("k") },
+		s.flush,
+	} {
+		s.storeMu.Lock()
+		done := make(chan struct{})
+		go func() {
+			del()
+			close(done)
+		}()
+		select {
+		case <-done:
+			t.Fatal("delete did not wait for the store lock")
+		case <-time.After(20 * time.Millisecond):
+		}
+		s.cache.Add("k", &entry{value: []byte("2")})
+		s.storeMu.Unlock()
+		<-done
+		if s.lookup("k") != nil {
+			t.Error("the key survived the delete")
+		}
+	}
+}
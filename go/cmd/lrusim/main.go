@@ -0,0 +1,231 @@
+// lrusim replays access traces against the lru package's caches
+// and prints hit ratios for a sweep of capacities.
+//
+//	lrusim -format arc -policy lru,sampled,opt -caps 1000,10000 P1.lis
+//	cat keys.txt | lrusim -output json
+//
+// Capacities are numbers of objects for every policy. When the trace has
+// sizes, gds is given capacity times the mean object size in bytes.
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	lru "github.com/Ninlgde/lrucache/go"
+)
+
+// 一行结果
+type result struct {
+	Policy   string  `json:"policy"`
+	Capacity int     `json:"capacity"`
+	Hits     int     `json:"hits"`
+	Misses   int     `json:"misses"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+func main() {
+	format := flag.String("format", formatPlain, "trace format: plain, csv, arc or lirs")
+	policies := flag.String("policy", "lru,opt", "comma separated policies: lru, sampled, gds, opt")
+	caps := flag.String("caps", "", "comma separated capacities, default is a sweep up to the number of distinct keys")
+	steps := flag.Int("steps", 10, "number of capacities in the default sweep")
+	samples := flag.Int("samples", 5, "samples per eviction for the sampled policy")
+	output := flag.String("output", "csv", "output format: csv or json")
+	flag.Parse()
+
+	t, err := load(flag.Args(), *format)
+	if err != nil {
+		fatal(err)
+	}
+
+	var capacities []int
+	if *caps != "" {
+		capacities, err = parseInts(*caps)
+		if err != nil {
+			fatal(err)
+		}
+	} else {
+		capacities = sweep(distinct(t.keys), *steps)
+	}
+
+	results := make([]result, 0)
+	for _, policy := range strings.Split(*policies, ",") {
+		policy = strings.TrimSpace(policy)
+		for _, c := range capacities {
+			r, err := run(t, policy, c, *samples)
+			if err != nil {
+				fatal(err)
+			}
+			results = append(results, result{
+				Policy:   policy,
+				Capacity: c,
+				Hits:     r.Hits,
+				Misses:   r.Misses,
+				HitRatio: r.HitRatio(),
+			})
+		}
+	}
+
+	if err := write(os.Stdout, results, *output); err != nil {
+		fatal(err)
+	}
+}
+
+// 读取所有的trace文件，没有文件时读stdin
+func load(files []string, format string) (*trace, error) {
+	if len(files) == 0 {
+		return readTrace(os.Stdin, format)
+	}
+	all := &trace{}
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		t, err := readTrace(f, format)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		if t.sizes != nil && all.sizes == nil {
+			all.sizes = ones(len(all.keys))
+		}
+		if all.sizes != nil && t.sizes == nil {
+			t.sizes = ones(len(t.keys))
+		}
+		all.keys = append(all.keys, t.keys...)
+		all.sizes = append(all.sizes, t.sizes...)
+	}
+	return all, nil
+}
+
+// 在一个策略上回放trace
+func run(t *trace, policy string, capacity, samples int) (lru.SimResult, error) {
+	switch policy {
+	case "lru":
+		return lru.Simulate(lru.NewThreadUnsafeLRUCache(capacity), t.keys), nil
+	case "sampled":
+		return lru.Simulate(lru.NewThreadUnsafeSampledLRUCache(capacity, samples), t.keys), nil
+	case "gds":
+		cache := lru.NewThreadUnsafeGDSCache(capacity)
+		if t.sizes == nil {
+			return lru.Simulate(cache, t.keys), nil
+		}
+		// 有大小信息时，gds的容量按大小计算
+		// 和其他策略放在同一个横轴上：容量是对象个数，乘以平均对象大小
+		cache = lru.NewThreadUnsafeGDSCache(int(math.Round(float64(capacity) * meanSize(t))))
+		var r lru.SimResult
+		for i, k := range t.keys {
+			if cache.Find(k) != nil {
+				r.Hits++
+				continue
+			}
+			r.Misses++
+			cache.AddWithCost(k, true, 1, t.sizes[i])
+		}
+		return r, nil
+	case "opt":
+		return lru.SimulateBelady(t.keys, capacity), nil
+	}
+	return lru.SimResult{}, fmt.Errorf("unknown policy %q", policy)
+}
+
+func write(w io.Writer, results []result, output string) error {
+	switch output {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"policy", "capacity", "hits", "misses", "hit_ratio"})
+		for _, r := range results {
+			cw.Write([]string{
+				r.Policy,
+				strconv.Itoa(r.Capacity),
+				strconv.Itoa(r.Hits),
+				strconv.Itoa(r.Misses),
+				strconv.FormatFloat(r.HitRatio, 'f', 6, 64),
+			})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown output format %q", output)
+}
+
+// 几何级数的容量，从1到max
+func sweep(max, steps int) []int {
+	if max < 1 {
+		max = 1
+	}
+	if steps < 1 {
+		steps = 1
+	}
+	capacities := make([]int, 0, steps)
+	for i := 1; i <= steps; i++ {
+		c := int(math.Round(math.Pow(float64(max), float64(i)/float64(steps))))
+		if len(capacities) > 0 && c <= capacities[len(capacities)-1] {
+			continue
+		}
+		capacities = append(capacities, c)
+	}
+	return capacities
+}
+
+func distinct(keys []interface{}) int {
+	seen := make(map[interface{}]struct{})
+	for _, k := range keys {
+		seen[k] = struct{}{}
+	}
+	return len(seen)
+}
+
+func parseInts(s string) ([]int, error) {
+	fields := strings.Split(s, ",")
+	ints := make([]int, 0, len(fields))
+	for _, f := range fields {
+		i, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || i <= 0 {
+			return nil, fmt.Errorf("bad capacity %q", f)
+		}
+		ints = append(ints, i)
+	}
+	return ints, nil
+}
+
+// 不同key的平均大小，同一个key取最后一次访问的大小
+func meanSize(t *trace) float64 {
+	sizes := make(map[interface{}]float64)
+	for i, k := range t.keys {
+		sizes[k] = t.sizes[i]
+	}
+	if len(sizes) == 0 {
+		return 1
+	}
+	total := 0.0
+	for _, size := range sizes {
+		total += size
+	}
+	return total / float64(len(sizes))
+}
+
+func ones(n int) []float64 {
+	s := make([]float64, n)
+	for i := range s {
+		s[i] = 1
+	}
+	return s
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "lrusim:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// 支持的trace格式
+const (
+	formatPlain = "plain" // 每行一个key
+	formatCSV   = "csv"   // timestamp,key[,size]
+	formatARC   = "arc"   // ARC论文的格式: startblock numblocks ignore requestnumber
+	formatLIRS  = "lirs"  // LIRS论文的格式: 每行一个block号
+)
+
+// 访问序列
+type trace struct {
+	keys  []interface{} // 访问的key
+	sizes []float64     // 每次访问的大小，没有大小信息时为nil
+}
+
+/**
+读取trace
+r: 输入
+format: plain/csv/arc/lirs
+*/
+func readTrace(r io.Reader, format string) (*trace, error) {
+	t := &trace{keys: make([]interface{}, 0, 1024)}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	records := 0 // 不算空行和注释的行数
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		records++
+		var err error
+		switch format {
+		case formatPlain:
+			t.keys = append(t.keys, text)
+		case formatCSV:
+			err = t.parseCSV(text, records == 1)
+		case formatARC:
+			err = t.parseARC(text)
+		case formatLIRS:
+			// LIRS trace里有 "*" 之类的分隔行，跳过不是数字的行
+			if block, e := strconv.ParseInt(text, 10, 64); e == nil {
+				t.keys = append(t.keys, block)
+			}
+		default:
+			return nil, fmt.Errorf("unknown trace format %q", format)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// timestamp,key[,size]，第一条记录(first)可以是表头，前面的空行和注释不算
+func (t *trace) parseCSV(text string, first bool) error {
+	fields := strings.Split(text, ",")
+	if len(fields) < 2 {
+		return fmt.Errorf("want timestamp,key[,size], got %q", text)
+	}
+	for i := range fields {
+		fields[i] = strings.TrimSpace(fields[i])
+	}
+	size := 1.0
+	if len(fields) >= 3 {
+		s, err := strconv.ParseFloat(fields[2], 64)
+		if err != nil {
+			if first {
+				return nil // header
+			}
+			return fmt.Errorf("bad size %q", fields[2])
+		}
+		size = s
+	}
+	if _, err := strconv.ParseFloat(fields[0], 64); err != nil {
+		if first {
+			return nil // header
+		}
+		return fmt.Errorf("bad timestamp %q", fields[0])
+	}
+	if len(fields) >= 3 && t.sizes == nil {
+		// 前面的访问没有大小，都当成1
+		t.sizes = make([]float64, len(t.keys), cap(t.keys))
+		for i := range t.sizes {
+			t.sizes[i] = 1
+		}
+	}
+	t.keys = append(t.keys, fields[1])
+	if t.sizes != nil {
+		t.sizes = append(t.sizes, size)
+	}
+	return nil
+}
+
+// startblock numblocks ignore requestnumber
+// 一行展开成numblocks次访问
+func (t *trace) parseARC(text string) error {
+	fields := strings.Fields(text)
+	if len(fields) < 2 {
+		return fmt.Errorf("want startblock numblocks, got %q", text)
+	}
+	start, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("bad startblock %q", fields[0])
+	}
+	n, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || n < 0 {
+		return fmt.Errorf("bad numblocks %q", fields[1])
+	}
+	for i := int64(0); i < n; i++ {
+		t.keys = append(t.keys, start+i)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestReadTrace_Plain(t *testing.T) {
+	tr, err := readTrace(strings.NewReader("a\nb\n\n# comment\na\n"), formatPlain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.keys) != 3 || tr.keys[2] != "a" || tr.sizes != nil {
+		t.Errorf("unexpected trace %v", tr.keys)
+	}
+}
+
+func TestReadTrace_CSV(t *testing.T) {
+	in := "timestamp,key,size\n1,a,10\n2,b,20\n3,a,10\n"
+	tr, err := readTrace(strings.NewReader(in), formatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.keys) != 3 || len(tr.sizes) != 3 || tr.sizes[1] != 20 {
+		t.Errorf("unexpected trace %v %v", tr.keys, tr.sizes)
+	}
+
+	if _, err := readTrace(strings.NewReader("1,a\nx,b\n"), formatCSV); err == nil {
+		t.Error("want error for bad timestamp")
+	}
+
+	// comments and blank lines before the header
+	in = "# exported trace\n\ntimestamp,key\n1,a\n"
+	tr, err = readTrace(strings.NewReader(in), formatCSV)
+	if err != nil || len(tr.keys) != 1 || tr.keys[0] != "a" {
+		t.Errorf("header after a comment: %v %v", tr, err)
+	}
+}
+
+func TestReadTrace_ARC(t *testing.T) {
+	tr, err := readTrace(strings.NewReader("100 3 0 1\n7 1 0 2\n"), formatARC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []int64{100, 101, 102, 7}
+	if len(tr.keys) != len(want) {
+		t.Fatalf("got %v", tr.keys)
+	}
+	for i, k := range want {
+		if tr.keys[i] != k {
+			t.Errorf("keys[%d] = %v, want %v", i, tr.keys[i], k)
+		}
+	}
+}
+
+func TestReadTrace_LIRS(t *testing.T) {
+	tr, err := readTrace(strings.NewReader("1\n2\n*\n1\n"), formatLIRS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tr.keys) != 3 || tr.keys[2] != int64(1) {
+		t.Errorf("unexpected trace %v", tr.keys)
+	}
+}
+
+func TestRun(t *testing.T) {
+	tr, _ := readTrace(strings.NewReader("1\n2\n3\n1\n2\n3\n"), formatLIRS)
+	for _, policy := range []string{"lru", "sampled", "gds", "opt"} {
+		r, err := run(tr, policy, 3, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Hits != 3 || r.Misses != 3 {
+			t.Errorf("%s: got %+v", policy, r)
+		}
+	}
+	if _, err := run(tr, "nope", 3, 5); err == nil {
+		t.Error("want error for unknown policy")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	results := []result{{"lru", 10, 3, 1, 0.75}}
+
+	var buf bytes.Buffer
+	if err := write(&buf, results, "csv"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "policy,capacity,hits,misses,hit_ratio\nlru,10,3,1,0.750000\n" {
+		t.Errorf("unexpected csv %q", buf.String())
+	}
+
+	buf.Reset()
+	if err := write(&buf, results, "json"); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []result
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil || decoded[0] != results[0] {
+		t.Errorf("unexpected json %s", buf.String())
+	}
+}
+
+func TestSweep(t *testing.T) {
+	s := sweep(1000, 3)
+	if len(s) != 3 || s[0] != 10 || s[1] != 100 || s[2] != 1000 {
+		t.Errorf("unexpected sweep %v", s)
+	}
+	if s := sweep(2, 10); len(s) != 2 {
+		t.Errorf("sweep should skip duplicates, got %v", s)
+	}
+}
+
+// with sizes gds is sized in bytes, so its capacity is scaled to the same axis as the others
+func TestRun_GDSSized(t *testing.T) {
+	in := "1,a,10\n2,b,10\n3,a,10\n4,b,10\n5,a,10\n6,b,10\n"
+	tr, err := readTrace(strings.NewReader(in), formatCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, policy := range []string{"lru", "gds"} {
+		r, err := run(tr, policy, 2, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Hits != 4 || r.Misses != 2 {
+			t.Errorf("%s: got %d hits %d misses, want 4 and 2", policy, r.Hits, r.Misses)
+		}
+	}
+	if m := meanSize(tr); m != 10 {
+		t.Errorf("mean size %v, want 10", m)
+	}
+}
@@ -0,0 +1,364 @@
+package lru
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sync"
+)
+
+var (
+	ErrUnsupportedType = errors.New("lru: unsupported type for codec")
+	ErrBadEncoding     = errors.New("lru: bad encoding")
+)
+
+// 编解码器
+// 把key和value(都是interface{})编码成[]byte，用于快照等需要把缓存内容移出进程的地方
+type Codec interface {
+	// encode a key or value
+	Marshal(v interface{}) ([]byte, error)
+
+	// decode a key or value
+	Unmarshal(data []byte) (interface{}, error)
+}
+
+var (
+	GobCodec    Codec = gobCodec{}
+	JSONCodec   Codec = jsonCodec{}
+	BinaryCodec Codec = binaryCodec{}
+)
+
+// find a built-in codec by name: gob, json or binary
+func LookupCodec(name string) (Codec, bool) {
+	switch name {
+	case "gob":
+		return GobCodec, true
+	case "json":
+		return JSONCodec, true
+	case "binary":
+		return BinaryCodec, true
+	}
+	return nil, false
+}
+
+/**
+自定义类型的注册表
+注册之后gob、json、binary三种编解码都可以还原出原来的类型
+name: 类型的名字，会写进编码结果里，所以注册之后不要改
+v: 这个类型的一个值
+*/
+func RegisterType(name string, v interface{}) {
+	t := reflect.TypeOf(v)
+	registry.Lock()
+	defer registry.Unlock()
+	if old, ok := registry.byName[name]; ok && old != t {
+		panic(fmt.Sprintf("lru: type name %q registered twice", name))
+	}
+	registry.byName[name] = t
+	registry.byType[t] = name
+	gob.RegisterName(name, v)
+}
+
+type typeRegistry struct {
+	byName map[string]reflect.Type
+	byType map[reflect.Type]string
+	sync.RWMutex
+}
+
+var registry = &typeRegistry{
+	byName: make(map[string]reflect.Type),
+	byType: make(map[reflect.Type]string),
+}
+
+func (r *typeRegistry) name(t reflect.Type) (string, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	name, ok := r.byType[t]
+	return name, ok
+}
+
+func (r *typeRegistry) lookup(name string) (reflect.Type, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	t, ok := r.byName[name]
+	return t, ok
+}
+
+/**
+gob编解码
+int、string等基础类型可以直接用
+自定义类型要先 RegisterType (或者 gob.Register)
+*/
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	// 编码指向interface的指针，这样才会带上具体的类型信息
+	if err := gob.NewEncoder(&buf).Encode(&v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte) (interface{}, error) {
+	var v interface{}
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+/**
+json编解码
+直接用json.Unmarshal到interface{}会把int变成float64，所以带上类型名
+	{"type":"int","value":1}
+自定义类型要先 RegisterType
+*/
+type jsonCodec struct{}
+
+type jsonEnvelope struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// json里内置的类型
+var jsonBuiltins = map[string]reflect.Type{
+	"string":  reflect.TypeOf(""),
+	"bytes":   reflect.TypeOf([]byte(nil)),
+	"int":     reflect.TypeOf(int(0)),
+	"int64":   reflect.TypeOf(int64(0)),
+	"uint64":  reflect.TypeOf(uint64(0)),
+	"float64": reflect.TypeOf(float64(0)),
+	"bool":    reflect.TypeOf(false),
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	if v == nil {
+		return json.Marshal(jsonEnvelope{Type: "nil"})
+	}
+	t := reflect.TypeOf(v)
+	name, ok := registry.name(t)
+	if !ok {
+		for n, bt := range jsonBuiltins {
+			if bt == t {
+				name, ok = n, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(jsonEnvelope{Type: name, Value: raw})
+}
+
+func (jsonCodec) Unmarshal(data []byte) (interface{}, error) {
+	var env jsonEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, err
+	}
+	if env.Type == "nil" {
+		return nil, nil
+	}
+	t, ok := jsonBuiltins[env.Type]
+	if !ok {
+		t, ok = registry.lookup(env.Type)
+	}
+	if !ok {
+		return nil, ErrUnsupportedType
+	}
+	p := reflect.New(t)
+	if err := json.Unmarshal(env.Value, p.Interface()); err != nil {
+		return nil, err
+	}
+	return p.Elem().Interface(), nil
+}
+
+/**
+紧凑的二进制编解码
+第一个字节是类型标记，后面是数据，变长的数据前面带长度(uvarint)
+	nil:     0
+	string:  1 len bytes
+	[]byte:  2 len bytes
+	int:     3 varint
+	int64:   4 varint
+	uint64:  5 uvarint
+	float64: 6 8字节
+	bool:    7 0/1
+	自定义:   255 len name len payload
+自定义类型实现了encoding.BinaryMarshaler时用它编码，否则用gob编码payload
+*/
+type binaryCodec struct{}
+
+const (
+	tagNil byte = iota
+	tagString
+	tagBytes
+	tagInt
+	tagInt64
+	tagUint64
+	tagFloat64
+	tagBool
+	tagCustom byte = 255
+)
+
+func (binaryCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf []byte
+	switch x := v.(type) {
+	case nil:
+		buf = append(buf, tagNil)
+	case string:
+		buf = append(buf, tagString)
+		buf = binary.AppendUvarint(buf, uint64(len(x)))
+		buf = append(buf, x...)
+	case []byte:
+		buf = append(buf, tagBytes)
+		buf = binary.AppendUvarint(buf, uint64(len(x)))
+		buf = append(buf, x...)
+	case int:
+		buf = append(buf, tagInt)
+		buf = binary.AppendVarint(buf, int64(x))
+	case int64:
+		buf = append(buf, tagInt64)
+		buf = binary.AppendVarint(buf, x)
+	case uint64:
+		buf = append(buf, tagUint64)
+		buf = binary.AppendUvarint(buf, x)
+	case float64:
+		buf = append(buf, tagFloat64)
+		buf = binary.BigEndian.AppendUint64(buf, math.Float64bits(x))
+	case bool:
+		buf = append(buf, tagBool)
+		if x {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	default:
+		name, ok := registry.name(reflect.TypeOf(v))
+		if !ok {
+			return nil, ErrUnsupportedType
+		}
+		var payload []byte
+		var err error
+		p := reflect.New(reflect.TypeOf(v))
+		p.Elem().Set(reflect.ValueOf(v))
+		if m, ok := binaryMarshaler(p); ok {
+			payload, err = m.MarshalBinary()
+		} else {
+			var b bytes.Buffer
+			err = gob.NewEncoder(&b).Encode(v)
+			payload = b.Bytes()
+		}
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, tagCustom)
+		buf = binary.AppendUvarint(buf, uint64(len(name)))
+		buf = append(buf, name...)
+		buf = binary.AppendUvarint(buf, uint64(len(payload)))
+		buf = append(buf, payload...)
+	}
+	return buf, nil
+}
+
+func (binaryCodec) Unmarshal(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, ErrBadEncoding
+	}
+	tag, data := data[0], data[1:]
+	// 读一段带长度的数据
+	chunk := func() ([]byte, error) {
+		n, l := binary.Uvarint(data)
+		if l <= 0 || uint64(len(data)-l) < n {
+			return nil, ErrBadEncoding
+		}
+		b := data[l : l+int(n)]
+		data = data[l+int(n):]
+		return b, nil
+	}
+	switch tag {
+	case tagNil:
+		return nil, nil
+	case tagString:
+		b, err := chunk()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case tagBytes:
+		b, err := chunk()
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte{}, b...), nil
+	case tagInt, tagInt64:
+		x, l := binary.Varint(data)
+		if l <= 0 {
+			return nil, ErrBadEncoding
+		}
+		if tag == tagInt {
+			return int(x), nil
+		}
+		return x, nil
+	case tagUint64:
+		x, l := binary.Uvarint(data)
+		if l <= 0 {
+			return nil, ErrBadEncoding
+		}
+		return x, nil
+	case tagFloat64:
+		if len(data) < 8 {
+			return nil, ErrBadEncoding
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case tagBool:
+		if len(data) < 1 {
+			return nil, ErrBadEncoding
+		}
+		return data[0] != 0, nil
+	case tagCustom:
+		name, err := chunk()
+		if err != nil {
+			return nil, err
+		}
+		payload, err := chunk()
+		if err != nil {
+			return nil, err
+		}
+		t, ok := registry.lookup(string(name))
+		if !ok {
+			return nil, ErrUnsupportedType
+		}
+		p := reflect.New(t)
+		if _, ok := binaryMarshaler(p); ok {
+			err = p.Interface().(encoding.BinaryUnmarshaler).UnmarshalBinary(payload)
+		} else {
+			err = gob.NewDecoder(bytes.NewReader(payload)).Decode(p.Interface())
+		}
+		if err != nil {
+			return nil, err
+		}
+		return p.Elem().Interface(), nil
+	}
+	return nil, ErrBadEncoding
+}
+
+// *T同时实现了BinaryMarshaler和BinaryUnmarshaler才用它们，否则两边都用gob
+func binaryMarshaler(p reflect.Value) (encoding.BinaryMarshaler, bool) {
+	if _, ok := p.Interface().(encoding.BinaryUnmarshaler); !ok {
+		return nil, false
+	}
+	m, ok := p.Interface().(encoding.BinaryMarshaler)
+	return m, ok
+}
@@ -0,0 +1,145 @@
+package lru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+type codecPoint struct {
+	X, Y int
+}
+
+// point with its own binary encoding
+type codecVec struct {
+	X, Y int32
+}
+
+func (v codecVec) MarshalBinary() ([]byte, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint32(b, uint32(v.X))
+	binary.BigEndian.PutUint32(b[4:], uint32(v.Y))
+	return b, nil
+}
+
+func (v *codecVec) UnmarshalBinary(b []byte) error {
+	if len(b) != 8 {
+		return ErrBadEncoding
+	}
+	v.X = int32(binary.BigEndian.Uint32(b))
+	v.Y = int32(binary.BigEndian.Uint32(b[4:]))
+	return nil
+}
+
+func init() {
+	RegisterType("lru.codecPoint", codecPoint{})
+	RegisterType("lru.codecVec", codecVec{})
+}
+
+var codecValues = []interface{}{
+	nil,
+	"",
+	"hello",
+	[]byte("bytes"),
+	0,
+	-42,
+	int64(1) << 40,
+	uint64(1) << 63,
+	3.25,
+	true,
+	false,
+	codecPoint{1, 2},
+	codecVec{-3, 4},
+}
+
+func testCodecRoundTrip(t *testing.T, name string, codec Codec) {
+	for _, v := range codecValues {
+		data, err := codec.Marshal(v)
+		if err != nil {
+			t.Errorf("%s: marshal %#v: %v", name, v, err)
+			continue
+		}
+		got, err := codec.Unmarshal(data)
+		if err != nil {
+			t.Errorf("%s: unmarshal %#v: %v", name, v, err)
+			continue
+		}
+		if b, ok := v.([]byte); ok {
+			if !bytes.Equal(b, got.([]byte)) {
+				t.Errorf("%s: %#v != %#v", name, v, got)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(v, got) {
+			t.Errorf("%s: %#v != %#v", name, v, got)
+		}
+	}
+}
+
+func TestGobCodec(t *testing.T) {
+	testCodecRoundTrip(t, "gob", GobCodec)
+}
+
+func TestJSONCodec(t *testing.T) {
+	testCodecRoundTrip(t, "json", JSONCodec)
+
+	data, _ := JSONCodec.Marshal(7)
+	Assert(string(data) == `{"type":"int","value":7}`, t)
+}
+
+func TestBinaryCodec(t *testing.T) {
+	testCodecRoundTrip(t, "binary", BinaryCodec)
+
+	data, _ := BinaryCodec.Marshal("abc")
+	Assert(bytes.Equal(data, []byte{tagString, 3, 'a', 'b', 'c'}), t)
+	data, _ = BinaryCodec.Marshal(codecVec{1, 2})
+	Assert(len(data) == 1+1+len("lru.codecVec")+1+8, t)
+}
+
+func TestBinaryCodec_Bad(t *testing.T) {
+	_, err := BinaryCodec.Unmarshal(nil)
+	Assert(err == ErrBadEncoding, t)
+	_, err = BinaryCodec.Unmarshal([]byte{tagString, 5, 'a'})
+	Assert(err == ErrBadEncoding, t)
+	_, err = BinaryCodec.Unmarshal([]byte{100})
+	Assert(err == ErrBadEncoding, t)
+}
+
+func TestCodec_Unsupported(t *testing.T) {
+	type unregistered struct{ A int }
+	_, err := BinaryCodec.Marshal(unregistered{1})
+	Assert(err == ErrUnsupportedType, t)
+	_, err = JSONCodec.Marshal(unregistered{1})
+	Assert(err == ErrUnsupportedType, t)
+}
+
+func TestLookupCodec(t *testing.T) {
+	for _, name := range []string{"gob", "json", "binary"} {
+		_, ok := LookupCodec(name)
+		Assert(ok, t)
+	}
+	_, ok := LookupCodec("xml")
+	Assert(!ok, t)
+}
+
+func TestSnapshot_Codecs(t *testing.T) {
+	for _, codec := range []Codec{GobCodec, JSONCodec, BinaryCodec} {
+		a := NewThreadUnsafeLRUCache(10)
+		a.(Snapshotter).SetCodec(codec)
+		a.Add("p", codecPoint{1, 2})
+		a.Add(2, codecVec{3, 4})
+
+		var buf bytes.Buffer
+		if err := a.(Snapshotter).SaveTo(&buf); err != nil {
+			t.Fatal(err)
+		}
+		b := NewThreadUnsafeLRUCache(10)
+		b.(Snapshotter).SetCodec(codec)
+		if err := b.(Snapshotter).LoadFrom(&buf); err != nil {
+			t.Fatal(err)
+		}
+		Assert(b.Find("p") == codecPoint{1, 2}, t)
+		Assert(b.Find(2) == codecVec{3, 4}, t)
+	}
+}
@@ -0,0 +1,249 @@
+package lru
+
+import (
+	"math/bits"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// 每个读缓冲的大小，必须是2的幂
+const readBufferSize = 64
+
+/**
+节点
+key不变，value原子读写，链表指针和removed只在维护锁里访问
+*/
+type ccNode struct {
+	key     lruKey
+	value   atomic.Pointer[lruValue]
+	prev    *ccNode
+	next    *ccNode
+	removed bool
+}
+
+/**
+读缓冲，一个有损的环形队列
+读者CAS抢一个位置写入，满了或者抢失败就丢弃这次访问记录(只影响淘汰的精度)
+维护锁里从头部取出来重放
+*/
+type readBuffer struct {
+	head atomic.Uint32 // 下一个要重放的位置，只有持有维护锁的才会改
+	tail atomic.Uint32 // 下一个要写的位置
+	buf  [readBufferSize]atomic.Pointer[ccNode]
+	_    [64]byte // 避免和下一个缓冲共享cache line
+}
+
+/**
+读不加锁的并发LRU(Caffeine的做法)
+数据放在sync.Map里，Find只查map，然后把访问记录写进一个随机选的读缓冲
+读缓冲满了时试着拿维护锁(拿不到就算了)，批量把访问记录重放到lru链表上
+写操作拿维护锁，先重放读缓冲，再改链表
+所以热点key的读不会互相阻塞，链表的顺序是近似的lru
+*/
+type concurrentLRU struct {
+	data    sync.Map // lruKey -> *ccNode
+	buffers []readBuffer
+	mask    uint32
+	size    atomic.Int64
+
+	mu      sync.Mutex // 维护锁
+	head    ccNode     // 哨兵，head.next是最旧的
+	tail    ccNode     // 哨兵，tail.prev是最新的
+	cap     int
+	onEvict func(k, v interface{})
+}
+
+func newConcurrentLRU() *concurrentLRU {
+	// 条带数是cpu数的4倍，向上取2的幂
+	n := 1 << bits.Len(uint(4*runtime.GOMAXPROCS(0)-1))
+	cache := &concurrentLRU{
+		buffers: make([]readBuffer, n),
+		mask:    uint32(n - 1),
+	}
+	cache.head.next = &cache.tail
+	cache.tail.prev = &cache.head
+	return cache
+}
+
+func (cache *concurrentLRU) Create(cap int) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.data.Clear()
+	for i := range cache.buffers {
+		b := &cache.buffers[i]
+		for j := range b.buf {
+			b.buf[j].Store(nil)
+		}
+		b.head.Store(b.tail.Load())
+	}
+	for p := cache.head.next; p != &cache.tail; p = p.next {
+		p.removed = true
+	}
+	cache.head.next = &cache.tail
+	cache.tail.prev = &cache.head
+	cache.size.Store(0)
+	cache.cap = cap
+}
+
+func (cache *concurrentLRU) Add(k lruKey, v lruValue) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.drain()
+	cache.add(k, v)
+}
+
+// 不加锁，只记录一次访问
+func (cache *concurrentLRU) Find(k lruKey) lruValue {
+	p, ok := cache.data.Load(k)
+	if !ok {
+		return nil
+	}
+	node := p.(*ccNode)
+	cache.record(node)
+	return *node.value.Load()
+}
+
+func (cache *concurrentLRU) Size() int {
+	return int(cache.size.Load())
+}
+
+func (cache *concurrentLRU) Remove(k lruKey) lruValue {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.remove(k)
+}
+
+/**
+设置淘汰回调
+回调在持有维护锁的时候调用，回调里不能再调用这个cache的写方法
+*/
+func (cache *concurrentLRU) SetOnEvict(fn func(k, v interface{})) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.onEvict = fn
+}
+
+/**
+遍历缓存中所有的数据的迭代器
+先重放读缓冲，然后在维护锁里拷贝一份链表，遍历的时候不持有锁
+reverse: 是否翻转 true = 正序 false = 倒序
+*/
+func (cache *concurrentLRU) Iterator(reverse bool) *Iterator {
+	return newSliceIterator(cache.pairs(reverse))
+}
+
+func (cache *concurrentLRU) Iter(reverse bool) <-chan lruPair {
+	return cache.Iterator(reverse).C
+}
+
+func (cache *concurrentLRU) pairs(reverse bool) []lruPair {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.drain()
+	pairs := make([]lruPair, 0, cache.size.Load())
+	for p := cache.head.next; p != &cache.tail; p = p.next {
+		pairs = append(pairs, lruPair{p.key, *p.value.Load()})
+	}
+	if !reverse {
+		reversePairs(pairs)
+	}
+	return pairs
+}
+
+// 添加或者更新，调用者持有维护锁并且已经重放过读缓冲
+func (cache *concurrentLRU) add(k lruKey, v lruValue) {
+	if p, ok := cache.data.Load(k); ok {
+		node := p.(*ccNode)
+		node.value.Store(&v)
+		cache.unlink(node)
+		cache.pushTail(node)
+		return
+	}
+	if cache.cap <= 0 {
+		return
+	}
+	node := &ccNode{key: k}
+	node.value.Store(&v)
+	cache.data.Store(k, node)
+	cache.pushTail(node)
+	if cache.size.Add(1) > int64(cache.cap) {
+		cache.evict()
+	}
+}
+
+// 调用者持有维护锁
+func (cache *concurrentLRU) remove(k lruKey) lruValue {
+	p, ok := cache.data.LoadAndDelete(k)
+	if !ok {
+		return nil
+	}
+	node := p.(*ccNode)
+	cache.unlink(node)
+	node.removed = true
+	cache.size.Add(-1)
+	return *node.value.Load()
+}
+
+// 写一条访问记录，缓冲满了就试着重放
+func (cache *concurrentLRU) record(node *ccNode) {
+	b := &cache.buffers[rand.Uint32()&cache.mask]
+	t := b.tail.Load()
+	if t-b.head.Load() < readBufferSize && b.tail.CompareAndSwap(t, t+1) {
+		b.buf[t&(readBufferSize-1)].Store(node)
+		if t+1-b.head.Load() < readBufferSize {
+			return
+		}
+	}
+	if cache.mu.TryLock() {
+		cache.drain()
+		cache.mu.Unlock()
+	}
+}
+
+/**
+重放所有读缓冲，调用者持有维护锁
+抢到位置但是还没写进来的记录留到下次
+*/
+func (cache *concurrentLRU) drain() {
+	for i := range cache.buffers {
+		b := &cache.buffers[i]
+		h, t := b.head.Load(), b.tail.Load()
+		for ; h != t; h++ {
+			node := b.buf[h&(readBufferSize-1)].Swap(nil)
+			if node == nil {
+				break
+			}
+			if !node.removed {
+				cache.unlink(node)
+				cache.pushTail(node)
+			}
+		}
+		b.head.Store(h)
+	}
+}
+
+// 淘汰最旧的，调用者持有维护锁
+func (cache *concurrentLRU) evict() {
+	node := cache.head.next
+	cache.data.CompareAndDelete(node.key, node)
+	cache.unlink(node)
+	node.removed = true
+	cache.size.Add(-1)
+	if cache.onEvict != nil {
+		cache.onEvict(node.key, *node.value.Load())
+	}
+}
+
+func (cache *concurrentLRU) unlink(node *ccNode) {
+	node.prev.next = node.next
+	node.next.prev = node.prev
+}
+
+func (cache *concurrentLRU) pushTail(node *ccNode) {
+	node.prev = cache.tail.prev
+	node.next = &cache.tail
+	cache.tail.prev.next = node
+	cache.tail.prev = node
+}
@@ -0,0 +1,96 @@
+package lru
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentLRU(t *testing.T) {
+	a := NewConcurrentLRUCache(3)
+	Assert(a.Find(1) == nil, t)
+	a.Add(1, 1)
+	a.Add(2, 2)
+	a.Add(3, 3)
+	// the read is replayed before the next write evicts
+	Assert(a.Find(1) == 1, t)
+	a.Add(4, 4)
+	Assert(a.Find(2) == nil, t)
+	Assert(a.Size() == 3, t)
+	AssertPairList([]lruPair{{3, 3}, {1, 1}, {4, 4}}, iterPairs(a), t)
+
+	a.Add(3, "three")
+	Assert(a.Find(3) == "three", t)
+	Assert(a.Remove(3) == "three", t)
+	Assert(a.Remove(3) == nil, t)
+	Assert(a.Size() == 2, t)
+
+	var evicted []interface{}
+	a.(Evictable).SetOnEvict(func(k, v interface{}) { evicted = append(evicted, k) })
+	a.Add(5, 5)
+	a.Add(6, 6)
+	Assert(len(evicted) == 1 && evicted[0] == 1, t)
+
+	a.Create(2)
+	Assert(a.Size() == 0 && a.Find(1) == nil, t)
+	a.Add(1, 1)
+	Assert(a.Find(1) == 1, t)
+
+	iterator := a.Iterator(true)
+	n := 0
+	for range iterator.C {
+		n++
+	}
+	Assert(n == 1, t)
+}
+
+// many more reads than a buffer holds still keep the hot keys
+func TestConcurrentLRU_HotKeys(t *testing.T) {
+	a := NewConcurrentLRUCache(100)
+	for i := 0; i < 100; i++ {
+		a.Add(i, i)
+	}
+	for r := 0; r < 100; r++ {
+		for i := 0; i < 10; i++ {
+			a.Find(i)
+		}
+	}
+	for i := 100; i < 180; i++ {
+		a.Add(i, i)
+	}
+	for i := 0; i < 10; i++ {
+		Assert(a.Find(i) == i, t)
+	}
+}
+
+func TestConcurrentLRU_Concurrent(t *testing.T) {
+	a := NewConcurrentLRUCache(50)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 5000; i++ {
+				k := strconv.Itoa((g*7 + i) % 120)
+				switch i % 10 {
+				case 0:
+					a.Remove(k)
+				case 1, 2:
+					a.Add(k, k)
+				case 3:
+					if i%1000 == 3 {
+						for range a.Iter(false) {
+						}
+					}
+				default:
+					if v := a.Find(k); v != nil && v != k {
+						t.Errorf("got %v for %v", v, k)
+					}
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	Assert(a.Size() <= 50, t)
+	Assert(len(iterPairs(a)) == a.Size(), t)
+}
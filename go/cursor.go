@@ -0,0 +1,121 @@
+package lru
+
+import "sync"
+
+/**
+拉取式的游标，不需要协程和channel
+两次Next之间不持有锁，遍历途中可以随意修改缓存
+手里的node指针只在node还在链表里、没有被回收复用(seq没变)时才用，否则从当前entry往后走
+新加和被移动(比如Find)的node都在链表尾部，seq比开始遍历时的mod大，遇到就结束
+所以是弱一致的：
+	开始遍历之后新加或者被移动的entry不会返回，每个entry最多返回一次
+	开始时就在、遍历到之前也没被删除或者移动的entry一定会返回
+	下一个要返回的entry和当前entry都被删除或者移动时，找不到位置，遍历提前结束
+	Create之后遍历结束
+用法：
+	c := cache.Cursor(false)
+	defer c.Close()
+	for c.Next() {
+		k, v := c.Entry()
+	}
+*/
+type Cursor struct {
+	c       *threadUnsafeLRU
+	lock    sync.Locker // 线程安全的缓存每次Next时加读锁，nil表示不加锁
+	reverse bool
+	started bool
+	done    bool
+	start   uint64   // 开始遍历时缓存的mod
+	head    *lruNode // 开始遍历时的头哨兵，变了说明缓存被Create过
+	cur     *lruNode // 当前entry的node
+	curSeq  uint64
+	next    *lruNode // 下一个要返回的node
+	nextSeq uint64
+	k       lruKey
+	v       lruValue
+}
+
+func newCursor(c *threadUnsafeLRU, lock sync.Locker, reverse bool) *Cursor {
+	return &Cursor{c: c, lock: lock, reverse: reverse}
+}
+
+/**
+移动到下一个entry
+return: false表示遍历结束
+*/
+func (cur *Cursor) Next() bool {
+	if cur.done {
+		return false
+	}
+	if cur.lock != nil {
+		cur.lock.Lock()
+		defer cur.lock.Unlock()
+	}
+	c := cur.c
+	if !cur.started {
+		cur.started = true
+		if c.len == 0 {
+			cur.Close()
+			return false
+		}
+		cur.start = c.mod
+		cur.head = c.head
+		cur.next = cur.step(cur.end())
+	} else if c.head != cur.head {
+		cur.Close()
+		return false
+	} else if !cur.valid(cur.next, cur.nextSeq) {
+		if !cur.valid(cur.cur, cur.curSeq) {
+			cur.Close()
+			return false
+		}
+		cur.next = cur.step(cur.cur)
+	}
+	if cur.next == cur.end() || cur.next.seq > cur.start {
+		cur.Close()
+		return false
+	}
+	cur.cur, cur.curSeq = cur.next, cur.next.seq
+	cur.k, cur.v = cur.cur.key, cur.cur.value
+	cur.next = cur.step(cur.cur)
+	cur.nextSeq = cur.next.seq
+	return true
+}
+
+// node还在链表里，而且没有被回收复用
+func (cur *Cursor) valid(n *lruNode, seq uint64) bool {
+	return n == cur.end() || n.prev != nil && n.seq == seq
+}
+
+// 当前的entry，Next返回true之后才有效
+func (cur *Cursor) Entry() (k, v interface{}) {
+	return cur.k, cur.v
+}
+
+// 结束遍历，释放引用，之后Next都返回false
+func (cur *Cursor) Close() {
+	cur.done = true
+	cur.head, cur.cur, cur.next = nil, nil, nil
+	cur.k, cur.v = nil, nil
+}
+
+// 遍历方向上的结束哨兵，同时也是起点的前一个
+func (cur *Cursor) end() *lruNode {
+	if cur.reverse {
+		return cur.c.tail
+	}
+	return cur.c.head
+}
+
+func (cur *Cursor) step(n *lruNode) *lruNode {
+	if cur.reverse {
+		if n == cur.c.tail {
+			return cur.c.head.next
+		}
+		return n.next
+	}
+	if n == cur.c.head {
+		return cur.c.tail.prev
+	}
+	return n.prev
+}
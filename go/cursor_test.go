@@ -0,0 +1,167 @@
+package lru
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func cursorPairs(c *Cursor) []lruPair {
+	var pairs []lruPair
+	for c.Next() {
+		k, v := c.Entry()
+		pairs = append(pairs, lruPair{k, v})
+	}
+	return pairs
+}
+
+func rangePairs(r Ranger, reverse bool) []lruPair {
+	var pairs []lruPair
+	r.Range(reverse, func(k, v interface{}) bool {
+		pairs = append(pairs, lruPair{k, v})
+		return true
+	})
+	return pairs
+}
+
+func TestCursor(t *testing.T) {
+	for _, a := range []LRUCache{NewLRUCache(4), NewThreadUnsafeLRUCache(4)} {
+		r := a.(Ranger)
+		Assert(len(cursorPairs(r.Cursor(false))) == 0, t)
+		for i := 1; i <= 5; i++ {
+			a.Add(i, i*10)
+		}
+		a.Find(3)
+		AssertPairList([]lruPair{{2, 20}, {4, 40}, {5, 50}, {3, 30}}, cursorPairs(r.Cursor(true)), t)
+		AssertPairList([]lruPair{{3, 30}, {5, 50}, {4, 40}, {2, 20}}, cursorPairs(r.Cursor(false)), t)
+		AssertPairList([]lruPair{{2, 20}, {4, 40}, {5, 50}, {3, 30}}, rangePairs(r, true), t)
+		AssertPairList([]lruPair{{3, 30}, {5, 50}, {4, 40}, {2, 20}}, rangePairs(r, false), t)
+
+		n := 0
+		r.Range(false, func(k, v interface{}) bool { n++; return n < 2 })
+		Assert(n == 2, t)
+
+		c := r.Cursor(false)
+		Assert(c.Next(), t)
+		c.Close()
+		Assert(!c.Next(), t)
+		Assert(!c.Next(), t)
+	}
+}
+
+// removing the current entry, or the next one, while walking
+func TestCursor_Modify(t *testing.T) {
+	a := NewThreadUnsafeLRUCache(10)
+	for i := 0; i < 10; i++ {
+		a.Add(i, i)
+	}
+	c := a.(Ranger).Cursor(true)
+	var seen []interface{}
+	for c.Next() {
+		k, _ := c.Entry()
+		seen = append(seen, k)
+		if k.(int) == 4 {
+			a.Remove(5) // the next one
+		} else {
+			a.Remove(k)
+		}
+		// freed nodes are reused by these adds, the cursor must not follow them
+		a.Add(k.(int)+100, 0)
+		if len(seen) > 20 {
+			break
+		}
+	}
+	Assert(len(seen) == 9, t)
+	expected := []interface{}{0, 1, 2, 3, 4, 6, 7, 8, 9}
+	for i := range expected {
+		Assert(seen[i] == expected[i], t)
+	}
+	Assert(a.Find(4) == 4 && a.Find(5) == nil, t)
+
+	// both anchors gone ends the walk
+	c = a.(Ranger).Cursor(false)
+	Assert(c.Next(), t)
+	k, _ := c.Entry()
+	a.Create(10)
+	Assert(!c.Next(), t)
+	Assert(k != nil, t)
+}
+
+// Find and Add in the body move entries to the tail, the walk still ends
+// and returns each entry that was there at the start once
+func TestCursor_FindAdd(t *testing.T) {
+	for _, a := range []LRUCache{NewLRUCache(10), NewThreadUnsafeLRUCache(10)} {
+		for _, reverse := range []bool{true, false} {
+			a.Create(10)
+			for i := 0; i < 5; i++ {
+				a.Add(i, i)
+			}
+			c := a.(Ranger).Cursor(reverse)
+			var seen []interface{}
+			for c.Next() {
+				k, _ := c.Entry()
+				seen = append(seen, k)
+				a.Find(k)
+				a.Add(k.(int)+100, 0)
+				if len(seen) > 10 {
+					t.Fatal("cursor did not end")
+				}
+			}
+			Assert(len(seen) == 5, t)
+			for i := range seen {
+				if reverse {
+					Assert(seen[i] == i, t)
+				} else {
+					Assert(seen[i] == 4-i, t)
+				}
+			}
+		}
+	}
+}
+
+// the iterator no longer needs a goroutine, dropping it half way leaks nothing
+func TestIterator_NoGoroutine(t *testing.T) {
+	a := NewLRUCache(100)
+	for i := 0; i < 100; i++ {
+		a.Add(i, i)
+	}
+	before := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		<-a.Iter(true)
+		it := a.Iterator(false)
+		<-it.C
+	}
+	Assert(runtime.NumGoroutine() == before, t)
+	// and does not hold the lock, so writers are not blocked
+	a.Add(1000, 1000)
+	Assert(a.Find(1000) == 1000, t)
+}
+
+func TestThreadSafeLRU_Cursor_Concurrent(t *testing.T) {
+	runtime.GOMAXPROCS(2)
+	a := NewLRUCache(CAP / 2)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < N; i++ {
+				k := (g*N + i) % CAP
+				a.Add(k, k)
+				if i%3 == 0 {
+					a.Remove(k)
+				}
+			}
+		}(g)
+	}
+	for i := 0; i < 20; i++ {
+		c := a.(Ranger).Cursor(i%2 == 0)
+		for c.Next() {
+			k, v := c.Entry()
+			if k != v {
+				t.Errorf("entry %v=%v", k, v)
+			}
+		}
+	}
+	wg.Wait()
+}
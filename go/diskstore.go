@@ -0,0 +1,359 @@
+package lru
+
+import (
+	"container/list"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// 磁盘上的淘汰策略
+type DiskPolicy int
+
+const (
+	DiskLRU  DiskPolicy = iota // 命中时移到最新
+	DiskFIFO                   // 按写入顺序淘汰
+)
+
+const (
+	defaultDiskBudget  = 64 << 20 // 磁盘默认的字节预算
+	defaultSegmentSize = 4 << 20  // 每个段文件的默认大小
+	diskRecordHeader   = 12       // keylen uint32, valuelen uint32, crc32 uint32
+)
+
+/**
+磁盘上的一条记录
+*/
+type diskEntry struct {
+	key    lruKey        // 缓存的key
+	seg    int           // 所在的段
+	offset int64         // 在段里的位置
+	size   int64         // 整条记录的大小
+	elem   *list.Element // 在淘汰队列里的位置
+}
+
+/**
+段文件
+只追加写，不修改；段里的记录全部失效后删除整个文件
+*/
+type diskSegment struct {
+	id   int
+	file *os.File
+	size int64 // 文件大小
+	live int64 // 还有效的记录的大小
+}
+
+/**
+日志结构的磁盘存储
+所有写入追加到当前的段，写满了开新段
+删除和淘汰只从索引里去掉，段里的有效数据变少
+有效数据少于一半的旧段会被整理: 把有效的记录搬到当前段，然后删除旧段
+数据只在进程内有效，打开时会清空目录里旧的段
+*/
+type diskStore struct {
+	dir     string
+	budget  int64 // 有效数据的字节预算
+	segSize int64 // 段的大小
+	policy  DiskPolicy
+	codec   Codec
+
+	dict     map[lruKey]*diskEntry // 索引
+	order    *list.List            // 淘汰队列，头部最先淘汰
+	segments map[int]*diskSegment
+	active   *diskSegment // 正在写的段
+	nextID   int
+	live     int64 // 有效数据的大小
+	closed   bool  // 关闭后put直接丢掉，索引是空的
+}
+
+func openDiskStore(dir string, budget, segSize int64, policy DiskPolicy, codec Codec) (*diskStore, error) {
+	if budget <= 0 {
+		budget = defaultDiskBudget
+	}
+	if segSize <= 0 {
+		segSize = defaultSegmentSize
+	}
+	if segSize > budget {
+		segSize = budget
+	}
+	if codec == nil {
+		codec = GobCodec
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	old, err := filepath.Glob(filepath.Join(dir, "seg-*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range old {
+		if err := os.Remove(name); err != nil {
+			return nil, err
+		}
+	}
+	s := &diskStore{
+		dir:      dir,
+		budget:   budget,
+		segSize:  segSize,
+		policy:   policy,
+		codec:    codec,
+		dict:     make(map[lruKey]*diskEntry),
+		order:    list.New(),
+		segments: make(map[int]*diskSegment),
+	}
+	if err := s.rotate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// entry的数量
+func (s *diskStore) len() int {
+	return len(s.dict)
+}
+
+/**
+写入一个entry，已经存在的会被覆盖
+超过预算时按策略淘汰旧的entry
+*/
+func (s *diskStore) put(k lruKey, v lruValue) error {
+	if s.closed {
+		return nil
+	}
+	kb, err := s.codec.Marshal(k)
+	if err != nil {
+		return err
+	}
+	vb, err := s.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	size := int64(diskRecordHeader + len(kb) + len(vb))
+	if size > s.budget {
+		s.remove(k)
+		return nil
+	}
+	seg, offset, err := s.append(kb, vb)
+	if err != nil {
+		return err
+	}
+	s.remove(k)
+	e := &diskEntry{key: k, seg: seg.id, offset: offset, size: size}
+	e.elem = s.order.PushBack(e)
+	s.dict[k] = e
+	seg.live += size
+	s.live += size
+	for s.live > s.budget {
+		s.remove(s.order.Front().Value.(*diskEntry).key)
+	}
+	return s.reclaim()
+}
+
+/**
+读取一个entry
+LRU策略下命中会移到队列尾部
+*/
+func (s *diskStore) get(k lruKey) (lruValue, bool, error) {
+	e, ok := s.dict[k]
+	if !ok {
+		return nil, false, nil
+	}
+	_, v, err := s.read(e)
+	if err != nil {
+		// 读不出来就当没有
+		s.remove(k)
+		return nil, false, err
+	}
+	if s.policy == DiskLRU {
+		s.order.MoveToBack(e.elem)
+	}
+	return v, true, nil
+}
+
+// 从索引里删除
+func (s *diskStore) remove(k lruKey) bool {
+	e, ok := s.dict[k]
+	if !ok {
+		return false
+	}
+	delete(s.dict, k)
+	s.order.Remove(e.elem)
+	s.live -= e.size
+	seg := s.segments[e.seg]
+	seg.live -= e.size
+	if seg.live == 0 && seg != s.active {
+		s.drop(seg)
+	}
+	return true
+}
+
+// 从最先淘汰到最后淘汰的所有entry
+func (s *diskStore) pairs() []lruPair {
+	pairs := make([]lruPair, 0, s.len())
+	for elem := s.order.Front(); elem != nil; elem = elem.Next() {
+		k, v, err := s.read(elem.Value.(*diskEntry))
+		if err == nil {
+			pairs = append(pairs, lruPair{k, v})
+		}
+	}
+	return pairs
+}
+
+// 清空
+func (s *diskStore) clear() error {
+	if s.closed {
+		return nil
+	}
+	for _, seg := range s.segments {
+		s.drop(seg)
+	}
+	s.dict = make(map[lruKey]*diskEntry)
+	s.order.Init()
+	s.live = 0
+	return s.rotate()
+}
+
+// 关闭并删除所有的段，可以重复调用
+func (s *diskStore) close() {
+	if s.closed {
+		return
+	}
+	for _, seg := range s.segments {
+		s.drop(seg)
+	}
+	s.dict = make(map[lruKey]*diskEntry)
+	s.order.Init()
+	s.live = 0
+	s.active = nil
+	s.closed = true
+}
+
+func (s *diskStore) append(kb, vb []byte) (*diskSegment, int64, error) {
+	size := int64(diskRecordHeader + len(kb) + len(vb))
+	if s.active.size > 0 && s.active.size+size > s.segSize {
+		if err := s.rotate(); err != nil {
+			return nil, 0, err
+		}
+	}
+	buf := make([]byte, 0, size)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(kb)))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(vb)))
+	crc := crc32.NewIEEE()
+	crc.Write(kb)
+	crc.Write(vb)
+	buf = binary.BigEndian.AppendUint32(buf, crc.Sum32())
+	buf = append(buf, kb...)
+	buf = append(buf, vb...)
+
+	seg := s.active
+	offset := seg.size
+	if _, err := seg.file.WriteAt(buf, offset); err != nil {
+		return nil, 0, err
+	}
+	seg.size += size
+	return seg, offset, nil
+}
+
+func (s *diskStore) read(e *diskEntry) (lruKey, lruValue, error) {
+	buf := make([]byte, e.size)
+	if _, err := s.segments[e.seg].file.ReadAt(buf, e.offset); err != nil {
+		return nil, nil, err
+	}
+	kl := int64(binary.BigEndian.Uint32(buf))
+	vl := int64(binary.BigEndian.Uint32(buf[4:]))
+	if diskRecordHeader+kl+vl != e.size {
+		return nil, nil, ErrBadEncoding
+	}
+	body := buf[diskRecordHeader:]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(buf[8:]) {
+		return nil, nil, ErrBadEncoding
+	}
+	k, err := s.codec.Unmarshal(body[:kl])
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := s.codec.Unmarshal(body[kl:])
+	return k, v, err
+}
+
+// 开一个新段
+func (s *diskStore) rotate() error {
+	s.nextID++
+	name := filepath.Join(s.dir, fmt.Sprintf("seg-%08d", s.nextID))
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	old := s.active
+	s.active = &diskSegment{id: s.nextID, file: f}
+	s.segments[s.active.id] = s.active
+	if old != nil && old.live == 0 {
+		s.drop(old)
+	}
+	return nil
+}
+
+func (s *diskStore) drop(seg *diskSegment) {
+	seg.file.Close()
+	os.Remove(seg.file.Name())
+	delete(s.segments, seg.id)
+}
+
+/**
+整理段
+磁盘上的总大小超过预算的两倍时，从有效数据比例最低的旧段开始，把有效的记录搬到当前段
+*/
+func (s *diskStore) reclaim() error {
+	for {
+		var total int64
+		old := make([]*diskSegment, 0, len(s.segments))
+		for _, seg := range s.segments {
+			total += seg.size
+			if seg != s.active {
+				old = append(old, seg)
+			}
+		}
+		if total <= 2*s.budget || len(old) == 0 {
+			return nil
+		}
+		sort.Slice(old, func(i, j int) bool {
+			return old[i].live*old[j].size < old[j].live*old[i].size
+		})
+		seg := old[0]
+		if seg.live*2 > seg.size {
+			return nil // 都还比较满，不值得整理
+		}
+		if err := s.move(seg); err != nil {
+			return err
+		}
+	}
+}
+
+// 把段里有效的记录搬到当前段，然后删除这个段
+func (s *diskStore) move(seg *diskSegment) error {
+	for elem := s.order.Front(); elem != nil; elem = elem.Next() {
+		e := elem.Value.(*diskEntry)
+		if e.seg != seg.id {
+			continue
+		}
+		buf := make([]byte, e.size)
+		if _, err := seg.file.ReadAt(buf, e.offset); err != nil {
+			return err
+		}
+		kl := binary.BigEndian.Uint32(buf)
+		body := buf[diskRecordHeader:]
+		to, offset, err := s.append(body[:kl], body[kl:])
+		if err != nil {
+			return err
+		}
+		seg.live -= e.size
+		to.live += e.size
+		e.seg = to.id
+		e.offset = offset
+	}
+	s.drop(seg)
+	return nil
+}
@@ -0,0 +1,161 @@
+package lru
+
+import "sync"
+
+// 内存 + 磁盘两层的缓存
+type DiskTieredCache interface {
+	LRUCache
+
+	// the first disk error since the cache was opened
+	Err() error
+
+	// close and delete the disk tier
+	// the cache keeps working in memory only, entries evicted after Close are dropped
+	Close() error
+}
+
+type DiskOptions struct {
+	// byte budget of the live entries on disk, default is 64MB
+	Budget int64
+
+	// size of one log segment file, default is 4MB
+	SegmentSize int64
+
+	// eviction order on disk, default is DiskLRU
+	Policy DiskPolicy
+
+	// codec for keys and values on disk, default is GobCodec
+	Codec Codec
+}
+
+/**
+两层缓存
+内存层是threadUnsafeLRU，容量满了淘汰的entry写到磁盘层
+Find内存没命中时查磁盘，磁盘命中就从磁盘删除并放回内存(可能又把另一个entry挤到磁盘)
+同一个key只会在一层里
+*/
+type diskTieredCache struct {
+	mem  *threadUnsafeLRU
+	disk *diskStore
+	err  error // 第一个磁盘错误
+	sync.Mutex
+}
+
+/**
+创建两层缓存
+cap: 内存层的容量
+dir: 磁盘层的目录，里面旧的段文件会被删除
+*/
+func NewDiskTieredCache(cap int, dir string, opts *DiskOptions) (DiskTieredCache, error) {
+	if opts == nil {
+		opts = &DiskOptions{}
+	}
+	disk, err := openDiskStore(dir, opts.Budget, opts.SegmentSize, opts.Policy, opts.Codec)
+	if err != nil {
+		return nil, err
+	}
+	cache := &diskTieredCache{disk: disk}
+	cache.mem = newThreadUnsafeLRU()
+	cache.mem.Create(cap)
+	cache.mem.SetOnEvict(cache.spill)
+	return cache, nil
+}
+
+func (cache *diskTieredCache) Create(cap int) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.mem.Create(cap)
+	cache.fail(cache.disk.clear())
+}
+
+func (cache *diskTieredCache) Add(k lruKey, v lruValue) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.disk.remove(k)
+	cache.mem.Add(k, v)
+}
+
+func (cache *diskTieredCache) Find(k lruKey) lruValue {
+	cache.Lock()
+	defer cache.Unlock()
+	if v := cache.mem.Find(k); v != nil {
+		return v
+	}
+	v, ok, err := cache.disk.get(k)
+	cache.fail(err)
+	if !ok {
+		return nil
+	}
+	// 提升到内存
+	cache.disk.remove(k)
+	cache.mem.Add(k, v)
+	return v
+}
+
+// 两层的entry数量之和
+func (cache *diskTieredCache) Size() int {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.mem.Size() + cache.disk.len()
+}
+
+func (cache *diskTieredCache) Remove(k lruKey) lruValue {
+	cache.Lock()
+	defer cache.Unlock()
+	if v := cache.mem.Remove(k); v != nil {
+		return v
+	}
+	v, ok, err := cache.disk.get(k)
+	cache.fail(err)
+	if !ok {
+		return nil
+	}
+	cache.disk.remove(k)
+	return v
+}
+
+/**
+遍历两层所有的数据
+reverse: true = 先磁盘(最先淘汰的在前)再内存 false = 反过来
+*/
+func (cache *diskTieredCache) Iterator(reverse bool) *Iterator {
+	return newSliceIterator(cache.pairs(reverse))
+}
+
+func (cache *diskTieredCache) Iter(reverse bool) <-chan lruPair {
+	return newSliceIterator(cache.pairs(reverse)).C
+}
+
+func (cache *diskTieredCache) Err() error {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.err
+}
+
+func (cache *diskTieredCache) Close() error {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.disk.close()
+	return cache.err
+}
+
+// 内存层淘汰的entry写到磁盘
+func (cache *diskTieredCache) spill(k, v interface{}) {
+	cache.fail(cache.disk.put(k, v))
+}
+
+func (cache *diskTieredCache) fail(err error) {
+	if err != nil && cache.err == nil {
+		cache.err = err
+	}
+}
+
+func (cache *diskTieredCache) pairs(reverse bool) []lruPair {
+	cache.Lock()
+	defer cache.Unlock()
+	pairs := append(cache.disk.pairs(), cache.mem.pairs()...)
+	if !reverse {
+		reversePairs(pairs)
+	}
+	return pairs
+}
@@ -0,0 +1,152 @@
+package lru
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newDiskTiered(t *testing.T, cap int, opts *DiskOptions) DiskTieredCache {
+	a, err := NewDiskTieredCache(cap, t.TempDir(), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close() })
+	return a
+}
+
+func TestDiskTiered_Spill(t *testing.T) {
+	a := newDiskTiered(t, 3, nil)
+	for i := 0; i < 10; i++ {
+		a.Add(i, i)
+	}
+	Assert(a.Size() == 10, t)
+	for i := 0; i < 10; i++ {
+		Assert(a.Find(i) == i, t)
+	}
+	Assert(a.Find(10) == nil, t)
+	Assert(a.Err() == nil, t)
+}
+
+func TestDiskTiered_Promote(t *testing.T) {
+	a := newDiskTiered(t, 2, nil)
+	a.Add(1, "one")
+	a.Add(2, "two")
+	a.Add(3, "three") // 1 spills to disk
+
+	Assert(a.Find(1) == "one", t) // 1 back to memory, 2 to disk
+	AssertPairList([]lruPair{{2, "two"}, {3, "three"}, {1, "one"}}, iterPairs(a), t)
+
+	// an Add replaces the stale disk copy
+	a.Add(2, "2")
+	Assert(a.Find(2) == "2", t)
+	Assert(a.Size() == 3, t)
+
+	Assert(a.Remove(3) == "three", t)
+	Assert(a.Remove(3) == nil, t)
+	Assert(a.Size() == 2, t)
+}
+
+func TestDiskTiered_Budget(t *testing.T) {
+	for _, policy := range []DiskPolicy{DiskLRU, DiskFIFO} {
+		a := newDiskTiered(t, 1, &DiskOptions{Budget: 1024, SegmentSize: 256, Policy: policy, Codec: BinaryCodec})
+		a.Add(0, make([]byte, 100))
+		for i := 1; i < 100; i++ {
+			a.Add(i, make([]byte, 100))
+			a.Find(0) // keep 0 hot
+		}
+		// at most ~8 records of ~116 bytes fit in 1KB
+		Assert(a.Size() <= 1+1024/116, t)
+		Assert(a.Find(99) != nil, t)
+		Assert(a.Find(1) == nil, t)
+		Assert(a.Err() == nil, t)
+	}
+}
+
+func TestDiskTiered_DiskPolicy(t *testing.T) {
+	// value 100 bytes, record ~116 bytes: 3 fit in the disk budget
+	for _, policy := range []DiskPolicy{DiskLRU, DiskFIFO} {
+		dir := t.TempDir()
+		s, err := openDiskStore(dir, 350, 128, policy, BinaryCodec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 3; i++ {
+			Assert(s.put(i, make([]byte, 100)) == nil, t)
+		}
+		s.get(0)
+		Assert(s.put(3, make([]byte, 100)) == nil, t)
+
+		_, ok0, _ := s.get(0)
+		_, ok1, _ := s.get(1)
+		if policy == DiskLRU {
+			Assert(ok0 && !ok1, t)
+		} else {
+			Assert(!ok0 && ok1, t)
+		}
+
+		// segments whose entries are all gone are deleted
+		segs, _ := filepath.Glob(filepath.Join(dir, "seg-*"))
+		Assert(len(segs) <= 4, t)
+		s.close()
+		segs, _ = filepath.Glob(filepath.Join(dir, "seg-*"))
+		Assert(len(segs) == 0, t)
+	}
+}
+
+func TestDiskTiered_Reclaim(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openDiskStore(dir, 1000, 200, DiskLRU, BinaryCodec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.close()
+	// keep rewriting the same few keys, the dead records pile up
+	for i := 0; i < 1000; i++ {
+		Assert(s.put(i%5, i) == nil, t)
+	}
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+	Assert(total <= 2*s.budget+s.segSize, t)
+	for i := 995; i < 1000; i++ {
+		v, ok, _ := s.get(i % 5)
+		Assert(ok && v == i, t)
+	}
+}
+
+func TestDiskTiered_Create(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "seg-00000042"), []byte("stale"), 0644)
+	a, err := NewDiskTieredCache(1, dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	_, err = os.Stat(filepath.Join(dir, "seg-00000042"))
+	Assert(os.IsNotExist(err), t)
+
+	a.Add(1, 1)
+	a.Add(2, 2)
+	a.Create(1)
+	Assert(a.Size() == 0, t)
+}
+
+// after Close the cache is memory only, evictions are dropped instead of crashing
+func TestDiskTiered_AfterClose(t *testing.T) {
+	a := newDiskTiered(t, 2, nil)
+	for i := 0; i < 5; i++ {
+		a.Add(i, i)
+	}
+	Assert(a.Close() == nil, t)
+	Assert(a.Close() == nil, t)
+	Assert(a.Size() == 2, t)
+	Assert(a.Find(0) == nil, t)
+	for i := 5; i < 10; i++ {
+		a.Add(i, i)
+	}
+	Assert(a.Size() == 2 && a.Find(9) == 9, t)
+	a.Create(2)
+	Assert(a.Size() == 0 && a.Err() == nil, t)
+}
@@ -0,0 +1,295 @@
+package lru
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// GreedyDual-Size(-Frequency) Cache
+// 按重新计算的代价淘汰，而不是只看最近访问时间
+type GDSCache interface {
+	LRUCache
+
+	// add key and value with cost (how expensive to recompute) and size
+	AddWithCost(k lruKey, v lruValue, cost, size float64)
+}
+
+/**
+gds node
+堆中的节点
+h = L + freq * cost / size
+*/
+type gdsNode struct {
+	key   lruKey   // 缓存的key
+	value lruValue // 缓存的值
+	cost  float64  // 重新计算的代价
+	size  float64  // 占用的空间
+	freq  float64  // 命中次数
+	h     float64  // 优先级
+	seq   uint64   // 最后访问的序号，优先级相同时先淘汰旧的
+	index int      // 在堆中的位置
+}
+
+// 最小堆，堆顶是下一个被淘汰的node
+type gdsHeap []*gdsNode
+
+func (h gdsHeap) Len() int { return len(h) }
+
+func (h gdsHeap) Less(i, j int) bool {
+	if h[i].h == h[j].h {
+		return h[i].seq < h[j].seq
+	}
+	return h[i].h < h[j].h
+}
+
+func (h gdsHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *gdsHeap) Push(x interface{}) {
+	node := x.(*gdsNode)
+	node.index = len(*h)
+	*h = append(*h, node)
+}
+
+func (h *gdsHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	node := old[n-1]
+	old[n-1] = nil
+	node.index = -1
+	*h = old[:n-1]
+	return node
+}
+
+/**
+GDS 缓存
+由一个map和一个最小堆组成
+添加、查找、删除都是O(log n)
+*/
+type threadUnsafeGDS struct {
+	dict map[lruKey]*gdsNode // 存放数据的 map
+	heap gdsHeap             // 按优先级排序的堆
+	l    float64             // 膨胀值L，等于最后一个被淘汰的node的优先级
+	used float64             // 当前占用的空间
+	cap  float64             // 总空间
+	seq  uint64              // 访问序号
+}
+
+func newThreadUnsafeGDS() *threadUnsafeGDS {
+	return &threadUnsafeGDS{}
+}
+
+/**
+创建缓存
+cap: 容量，所有entry的size之和不超过cap
+*/
+func (cache *threadUnsafeGDS) Create(cap int) {
+	cache.dict = make(map[lruKey]*gdsNode)
+	cache.heap = make(gdsHeap, 0)
+	cache.l = 0
+	cache.used = 0
+	cache.cap = float64(cap)
+	cache.seq = 0
+}
+
+/**
+添加一个元素，cost和size都是1
+此时GDS退化为 LFU + 老化
+*/
+func (cache *threadUnsafeGDS) Add(k lruKey, v lruValue) {
+	cache.AddWithCost(k, v, 1, 1)
+}
+
+/**
+添加一个元素
+k: key
+v: value
+cost: 重新计算的代价
+size: 占用的空间，大于cap的元素不会被缓存
+
+cost: O(log n)
+*/
+func (cache *threadUnsafeGDS) AddWithCost(k lruKey, v lruValue, cost, size float64) {
+	if size <= 0 {
+		size = 1
+	}
+	node, ok := cache.dict[k]
+	if ok {
+		// 命中，先从堆里拿出来，避免腾空间的时候把自己淘汰了
+		heap.Remove(&cache.heap, node.index)
+		delete(cache.dict, k)
+		cache.used -= node.size
+	} else {
+		node = &gdsNode{key: k, index: -1}
+	}
+	if size > cache.cap {
+		return
+	}
+	node.value = v
+	node.cost = cost
+	node.size = size
+	cache.used += size
+	cache.evict()
+	cache.dict[k] = node
+	cache.touch(node)
+}
+
+/**
+查找一个元素
+命中时增加频率并重新计算优先级
+
+cost: O(log n)
+*/
+func (cache *threadUnsafeGDS) Find(k lruKey) lruValue {
+	node, ok := cache.dict[k]
+	if !ok {
+		return nil
+	}
+	cache.touch(node)
+	return node.value
+}
+
+/**
+当前缓存大小
+return: entry的数量
+*/
+func (cache *threadUnsafeGDS) Size() int {
+	return len(cache.dict)
+}
+
+/**
+删除一个元素
+k: key
+return: value or nil
+*/
+func (cache *threadUnsafeGDS) Remove(k lruKey) lruValue {
+	node, ok := cache.dict[k]
+	if !ok {
+		return nil
+	}
+	heap.Remove(&cache.heap, node.index)
+	delete(cache.dict, k)
+	cache.used -= node.size
+	return node.value
+}
+
+/**
+遍历缓存中所有的数据的迭代器
+reverse: true = 从下一个被淘汰的开始 false = 从优先级最高的开始
+*/
+func (cache *threadUnsafeGDS) Iterator(reverse bool) *Iterator {
+	return newSliceIterator(cache.pairs(reverse))
+}
+
+func (cache *threadUnsafeGDS) Iter(reverse bool) <-chan lruPair {
+	return newSliceIterator(cache.pairs(reverse)).C
+}
+
+/**
+命中时重新计算优先级
+H = L + freq * cost / size
+*/
+func (cache *threadUnsafeGDS) touch(node *gdsNode) {
+	cache.seq++
+	node.freq++
+	node.seq = cache.seq
+	node.h = cache.l + node.freq*node.cost/node.size
+	if node.index < 0 {
+		heap.Push(&cache.heap, node)
+		return
+	}
+	heap.Fix(&cache.heap, node.index)
+}
+
+/**
+淘汰优先级最低的node，直到空间足够
+每次淘汰都把L膨胀到被淘汰node的优先级
+*/
+func (cache *threadUnsafeGDS) evict() {
+	for cache.used > cache.cap && len(cache.heap) > 0 {
+		node := heap.Pop(&cache.heap).(*gdsNode)
+		delete(cache.dict, node.key)
+		cache.used -= node.size
+		cache.l = node.h
+	}
+}
+
+// 按优先级排序的所有entry
+func (cache *threadUnsafeGDS) pairs(reverse bool) []lruPair {
+	nodes := make(gdsHeap, len(cache.heap))
+	copy(nodes, cache.heap)
+	sort.Slice(nodes, func(i, j int) bool {
+		if reverse {
+			return nodes.Less(i, j)
+		}
+		return nodes.Less(j, i)
+	})
+	pairs := make([]lruPair, len(nodes))
+	for i, node := range nodes {
+		pairs[i] = lruPair{node.key, node.value}
+	}
+	return pairs
+}
+
+/**
+线程安全的GDS缓存
+*/
+type threadSafeGDS struct {
+	c          *threadUnsafeGDS
+	sync.Mutex // 协程锁，Find也会修改堆，所以不用读写锁
+}
+
+func newThreadSafeGDS() *threadSafeGDS {
+	return &threadSafeGDS{}
+}
+
+func (cache *threadSafeGDS) Create(cap int) {
+	cache.c = newThreadUnsafeGDS()
+	cache.c.Create(cap)
+}
+
+func (cache *threadSafeGDS) Add(k lruKey, v lruValue) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.c.Add(k, v)
+}
+
+func (cache *threadSafeGDS) AddWithCost(k lruKey, v lruValue, cost, size float64) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.c.AddWithCost(k, v, cost, size)
+}
+
+func (cache *threadSafeGDS) Find(k lruKey) lruValue {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Find(k)
+}
+
+func (cache *threadSafeGDS) Size() int {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Size()
+}
+
+func (cache *threadSafeGDS) Remove(k lruKey) lruValue {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Remove(k)
+}
+
+func (cache *threadSafeGDS) Iterator(reverse bool) *Iterator {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Iterator(reverse)
+}
+
+func (cache *threadSafeGDS) Iter(reverse bool) <-chan lruPair {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Iter(reverse)
+}
@@ -0,0 +1,113 @@
+package lru
+
+import "testing"
+
+func TestGDS_Add(t *testing.T) {
+	a := NewGDSCache(10)
+
+	a.Add(1, 1)
+	a.Add(2, "two")
+	a.AddWithCost(3, 3, 5, 2)
+
+	Assert(a.Size() == 3, t)
+	Assert(a.Find(1) == 1, t)
+	Assert(a.Find(2) == "two", t)
+	Assert(a.Find(3) == 3, t)
+	Assert(a.Find(4) == nil, t)
+}
+
+func TestGDS_Evict_Cost(t *testing.T) {
+	a := NewThreadUnsafeGDSCache(3)
+
+	a.AddWithCost("report", "r", 3000, 1) // expensive
+	a.AddWithCost("query1", "q1", 5, 1)
+	a.AddWithCost("query2", "q2", 5, 1)
+	a.AddWithCost("query3", "q3", 5, 1) // evicts query1
+
+	Assert(a.Size() == 3, t)
+	Assert(a.Find("report") == "r", t)
+	Assert(a.Find("query1") == nil, t)
+	Assert(a.Find("query3") == "q3", t)
+}
+
+func TestGDS_Evict_Size(t *testing.T) {
+	a := NewThreadUnsafeGDSCache(10)
+
+	a.AddWithCost(1, 1, 10, 8) // h = 10/8
+	a.AddWithCost(2, 2, 10, 1) // h = 10
+	a.AddWithCost(3, 3, 10, 2) // need space, evict 1
+
+	Assert(a.Find(1) == nil, t)
+	Assert(a.Find(2) == 2, t)
+	Assert(a.Find(3) == 3, t)
+
+	// bigger than cap, never cached
+	a.AddWithCost(4, 4, 10, 11)
+	Assert(a.Find(4) == nil, t)
+	Assert(a.Size() == 2, t)
+}
+
+func TestGDS_Inflation(t *testing.T) {
+	a := NewThreadUnsafeGDSCache(2)
+
+	a.AddWithCost(1, 1, 100, 1)
+	for i := 0; i < 200; i++ {
+		a.AddWithCost(i+2, i, 1, 1)
+	}
+	// L grows with every eviction, so the old expensive entry finally ages out
+	Assert(a.Find(1) == nil, t)
+	Assert(a.Size() == 2, t)
+}
+
+func TestGDS_Update(t *testing.T) {
+	a := NewThreadUnsafeGDSCache(2)
+
+	a.Add(1, 1)
+	a.Add(2, 2)
+	a.Add(1, "one")
+
+	Assert(a.Size() == 2, t)
+	Assert(a.Find(1) == "one", t)
+
+	// update with a size bigger than cap drops the entry
+	a.AddWithCost(1, 1, 1, 3)
+	Assert(a.Find(1) == nil, t)
+	Assert(a.Size() == 1, t)
+}
+
+func TestGDS_Remove(t *testing.T) {
+	a := NewGDSCache(10)
+
+	a.Add(1, 1)
+	a.Add(2, "two")
+
+	Assert(a.Remove(2) == "two", t)
+	Assert(a.Remove(2) == nil, t)
+	Assert(a.Size() == 1, t)
+	Assert(a.Remove(1) == 1, t)
+	Assert(a.Size() == 0, t)
+}
+
+func TestGDS_Iter(t *testing.T) {
+	a := NewGDSCache(10)
+
+	a.AddWithCost(1, 1, 3, 1)
+	a.AddWithCost(2, 2, 1, 1)
+	a.AddWithCost(3, 3, 2, 1)
+
+	resultt := make([]lruPair, 0, 3)
+	for p := range a.Iter(true) {
+		resultt = append(resultt, p)
+	}
+	AssertPairList([]lruPair{{2, 2}, {3, 3}, {1, 1}}, resultt, t)
+
+	iterator := a.Iterator(false)
+	resultf := make([]lruPair, 0, 3)
+	for p := range iterator.C {
+		resultf = append(resultf, p)
+		if p.k.(int) == 3 {
+			iterator.Stop()
+		}
+	}
+	AssertPairList([]lruPair{{1, 1}, {3, 3}}, resultf, t)
+}
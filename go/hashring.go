@@ -0,0 +1,81 @@
+package lru
+
+import (
+	"sort"
+	"strconv"
+)
+
+const defaultRingReplicas = 50
+
+/**
+一致性哈希环
+每个节点在环上放replicas个虚拟节点，key顺时针找到的第一个虚拟节点就是它的owner
+增删一个节点只会移动大约1/n的key
+不是线程安全的
+*/
+type HashRing struct {
+	replicas int
+	hashes   []uint64          // 排好序的虚拟节点
+	nodes    map[uint64]string // 虚拟节点 -> 节点
+}
+
+// replicas is the number of virtual nodes per node, 0 means 50
+func NewHashRing(replicas int) *HashRing {
+	if replicas <= 0 {
+		replicas = defaultRingReplicas
+	}
+	return &HashRing{
+		replicas: replicas,
+		nodes:    make(map[uint64]string),
+	}
+}
+
+// add nodes to the ring
+func (r *HashRing) Add(nodes ...string) {
+	for _, node := range nodes {
+		for i := 0; i < r.replicas; i++ {
+			h := fnvString(strconv.Itoa(i) + node)
+			if _, ok := r.nodes[h]; ok {
+				continue
+			}
+			r.nodes[h] = node
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool { return r.hashes[i] < r.hashes[j] })
+}
+
+// remove a node and its virtual nodes from the ring
+func (r *HashRing) Remove(node string) {
+	hashes := r.hashes[:0]
+	for _, h := range r.hashes {
+		if r.nodes[h] == node {
+			delete(r.nodes, h)
+			continue
+		}
+		hashes = append(hashes, h)
+	}
+	r.hashes = hashes
+}
+
+// the owner of k, "" if the ring is empty
+func (r *HashRing) Get(k interface{}) string {
+	if len(r.hashes) == 0 {
+		return ""
+	}
+	h := hashKey(k)
+	i := sort.Search(len(r.hashes), func(i int) bool { return r.hashes[i] >= h })
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[r.hashes[i]]
+}
+
+// the number of nodes in the ring
+func (r *HashRing) Len() int {
+	seen := make(map[string]struct{})
+	for _, node := range r.nodes {
+		seen[node] = struct{}{}
+	}
+	return len(seen)
+}
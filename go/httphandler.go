@@ -0,0 +1,252 @@
+package lru
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	defaultPageLimit = 100
+	maxPageLimit     = 1000
+	maxHTTPBodySize  = 32 << 20
+)
+
+/**
+用http/json暴露缓存，方便调试和简单的客户端
+	GET    /keys/{key}        读一个key
+	PUT    /keys/{key}        写一个key
+	DELETE /keys/{key}        删一个key
+	GET    /keys?offset=&limit=&reverse=  分页列出所有key，reverse和Iterator(reverse)一样
+	GET    /stats             统计
+	POST   /flush             清空
+PUT按Content-Type解码请求体:
+	application/json 解码成json值，text/* 存成string，其他存成[]byte
+GET按值的类型编码: string是text/plain，[]byte是application/octet-stream，其他是json
+Accept: application/json 时总是返回json
+key都是string，通过Go接口写入的非string的key只能在列表里看到
+*/
+type HTTPHandler struct {
+	cache LRUCache
+	cap   int
+	mux   *http.ServeMux
+
+	hits    atomic.Int64
+	misses  atomic.Int64
+	puts    atomic.Int64
+	deletes atomic.Int64
+}
+
+// 列表的一项
+type httpItem struct {
+	Key   interface{} `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// 列表的一页，Next是下一页的offset，没有下一页时省略
+type httpPage struct {
+	Items []httpItem `json:"items"`
+	Next  *int       `json:"next,omitempty"`
+}
+
+type httpStats struct {
+	Size    int   `json:"size"`
+	Cap     int   `json:"cap"`
+	Hits    int64 `json:"hits"`
+	Misses  int64 `json:"misses"`
+	Puts    int64 `json:"puts"`
+	Deletes int64 `json:"deletes"`
+}
+
+// cap is used to recreate the cache on flush
+func NewHTTPHandler(cache LRUCache, cap int) *HTTPHandler {
+	h := &HTTPHandler{
+		cache: cache,
+		cap:   cap,
+		mux:   http.NewServeMux(),
+	}
+	h.mux.HandleFunc("GET /keys/{key...}", h.get)
+	h.mux.HandleFunc("PUT /keys/{key...}", h.put)
+	h.mux.HandleFunc("DELETE /keys/{key...}", h.delete)
+	h.mux.HandleFunc("GET /keys", h.list)
+	h.mux.HandleFunc("GET /stats", h.stats)
+	h.mux.HandleFunc("POST /flush", h.flush)
+	return h
+}
+
+func (h *HTTPHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+func (h *HTTPHandler) get(w http.ResponseWriter, r *http.Request) {
+	v := h.cache.Find(r.PathValue("key"))
+	if v == nil {
+		h.misses.Add(1)
+		writeHTTPError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	h.hits.Add(1)
+	if acceptsJSON(r) {
+		writeJSON(w, http.StatusOK, v)
+		return
+	}
+	switch v := v.(type) {
+	case string:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, v)
+	case []byte:
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(v)
+	default:
+		writeJSON(w, http.StatusOK, v)
+	}
+}
+
+func (h *HTTPHandler) put(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxHTTPBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeHTTPError(w, http.StatusRequestEntityTooLarge, err.Error())
+		} else {
+			writeHTTPError(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+	v, err := decodeHTTPValue(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.cache.Add(r.PathValue("key"), v)
+	h.puts.Add(1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *HTTPHandler) delete(w http.ResponseWriter, r *http.Request) {
+	if h.cache.Remove(r.PathValue("key")) == nil {
+		writeHTTPError(w, http.StatusNotFound, "key not found")
+		return
+	}
+	h.deletes.Add(1)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/**
+分页列出缓存
+offset是跳过的项数，列表在两次请求之间变化时分页可能会重复或者漏掉项
+*/
+func (h *HTTPHandler) list(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	offset, err := queryInt(q.Get("offset"), 0)
+	if err != nil || offset < 0 {
+		writeHTTPError(w, http.StatusBadRequest, "invalid offset")
+		return
+	}
+	limit, err := queryInt(q.Get("limit"), defaultPageLimit)
+	if err != nil || limit <= 0 {
+		writeHTTPError(w, http.StatusBadRequest, "invalid limit")
+		return
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+	reverse := false
+	if s := q.Get("reverse"); s != "" {
+		if reverse, err = strconv.ParseBool(s); err != nil {
+			writeHTTPError(w, http.StatusBadRequest, "invalid reverse")
+			return
+		}
+	}
+
+	page := httpPage{Items: make([]httpItem, 0)}
+	iterator := h.cache.Iterator(reverse)
+	i := 0
+	for p := range iterator.C {
+		if i >= offset+limit {
+			// 多读一项判断有没有下一页
+			next := i
+			page.Next = &next
+			iterator.Stop()
+			break
+		}
+		if i >= offset {
+			page.Items = append(page.Items, httpItem{p.k, p.v})
+		}
+		i++
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (h *HTTPHandler) stats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, httpStats{
+		Size:    h.cache.Size(),
+		Cap:     h.cap,
+		Hits:    h.hits.Load(),
+		Misses:  h.misses.Load(),
+		Puts:    h.puts.Load(),
+		Deletes: h.deletes.Load(),
+	})
+}
+
+func (h *HTTPHandler) flush(w http.ResponseWriter, r *http.Request) {
+	h.cache.Create(h.cap)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// 按Content-Type解码请求体
+func decodeHTTPValue(contentType string, body []byte) (interface{}, error) {
+	mediaType := ""
+	if contentType != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil, err
+		}
+		if v == nil {
+			return nil, errors.New("null value")
+		}
+		return v, nil
+	case strings.HasPrefix(mediaType, "text/"):
+		return string(body), nil
+	default:
+		return body, nil
+	}
+}
+
+func acceptsJSON(r *http.Request) bool {
+	for _, s := range strings.Split(r.Header.Get("Accept"), ",") {
+		if t, _, err := mime.ParseMediaType(s); err == nil && t == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+func queryInt(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	return strconv.Atoi(s)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeHTTPError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,156 @@
+package lru
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func doHTTP(h http.Handler, method, target, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHTTPHandler_Keys(t *testing.T) {
+	cache := NewLRUCache(10)
+	h := NewHTTPHandler(cache, 10)
+
+	Assert(doHTTP(h, "GET", "/keys/a", "", "").Code == http.StatusNotFound, t)
+
+	Assert(doHTTP(h, "PUT", "/keys/a", "text/plain; charset=utf-8", "hello").Code == http.StatusNoContent, t)
+	Assert(cache.Find("a") == "hello", t)
+	rec := doHTTP(h, "GET", "/keys/a", "", "")
+	Assert(rec.Code == http.StatusOK, t)
+	Assert(rec.Body.String() == "hello", t)
+	Assert(strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"), t)
+
+	// json bodies are decoded, so Go callers see the value
+	doHTTP(h, "PUT", "/keys/j", "application/json", `{"n":1}`)
+	Assert(cache.Find("j").(map[string]interface{})["n"] == float64(1), t)
+	rec = doHTTP(h, "GET", "/keys/j", "", "")
+	Assert(strings.TrimSpace(rec.Body.String()) == `{"n":1}`, t)
+	Assert(rec.Header().Get("Content-Type") == "application/json", t)
+
+	// anything else is stored as bytes
+	doHTTP(h, "PUT", "/keys/b", "application/octet-stream", "\x00\x01")
+	Assert(string(cache.Find("b").([]byte)) == "\x00\x01", t)
+	rec = doHTTP(h, "GET", "/keys/b", "", "")
+	Assert(rec.Body.String() == "\x00\x01", t)
+
+	// keys may contain slashes
+	doHTTP(h, "PUT", "/keys/x/y", "text/plain", "z")
+	Assert(cache.Find("x/y") == "z", t)
+
+	Assert(doHTTP(h, "PUT", "/keys/bad", "application/json", "{").Code == http.StatusBadRequest, t)
+
+	Assert(doHTTP(h, "DELETE", "/keys/a", "", "").Code == http.StatusNoContent, t)
+	Assert(doHTTP(h, "DELETE", "/keys/a", "", "").Code == http.StatusNotFound, t)
+	Assert(cache.Find("a") == nil, t)
+}
+
+func TestHTTPHandler_AcceptJSON(t *testing.T) {
+	cache := NewLRUCache(10)
+	h := NewHTTPHandler(cache, 10)
+	cache.Add("s", "text")
+
+	req := httptest.NewRequest("GET", "/keys/s", nil)
+	req.Header.Set("Accept", "text/html, application/json;q=0.9")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	Assert(strings.TrimSpace(rec.Body.String()) == `"text"`, t)
+}
+
+func TestHTTPHandler_List(t *testing.T) {
+	cache := NewLRUCache(10)
+	h := NewHTTPHandler(cache, 10)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		cache.Add(k, k)
+	}
+
+	page := func(target string) ([]string, *int) {
+		rec := doHTTP(h, "GET", target, "", "")
+		Assert(rec.Code == http.StatusOK, t)
+		var p struct {
+			Items []httpItem `json:"items"`
+			Next  *int       `json:"next"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+			t.Fatal(err)
+		}
+		keys := make([]string, 0, len(p.Items))
+		for _, item := range p.Items {
+			keys = append(keys, item.Key.(string))
+		}
+		return keys, p.Next
+	}
+
+	keys, next := page("/keys?limit=2")
+	Assert(strings.Join(keys, "") == "ed", t)
+	Assert(next != nil && *next == 2, t)
+	keys, next = page("/keys?limit=2&offset=4")
+	Assert(strings.Join(keys, "") == "a", t)
+	Assert(next == nil, t)
+
+	// reverse walks from the oldest entry, like Iterator(true)
+	keys, next = page("/keys?reverse=true&limit=3")
+	Assert(strings.Join(keys, "") == "abc", t)
+	Assert(*next == 3, t)
+	keys, next = page("/keys?reverse=true&offset=3")
+	Assert(strings.Join(keys, "") == "de", t)
+	Assert(next == nil, t)
+
+	keys, _ = page("/keys?offset=10")
+	Assert(len(keys) == 0, t)
+
+	Assert(doHTTP(h, "GET", "/keys?limit=0", "", "").Code == http.StatusBadRequest, t)
+	Assert(doHTTP(h, "GET", "/keys?reverse=maybe", "", "").Code == http.StatusBadRequest, t)
+}
+
+func TestHTTPHandler_StatsAndFlush(t *testing.T) {
+	cache := NewLRUCache(10)
+	h := NewHTTPHandler(cache, 10)
+	doHTTP(h, "PUT", "/keys/a", "text/plain", "1")
+	doHTTP(h, "GET", "/keys/a", "", "")
+	doHTTP(h, "GET", "/keys/b", "", "")
+
+	rec := doHTTP(h, "GET", "/stats", "", "")
+	var s httpStats
+	if err := json.Unmarshal(rec.Body.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	}
+	Assert(s == httpStats{Size: 1, Cap: 10, Hits: 1, Misses: 1, Puts: 1}, t)
+
+	Assert(doHTTP(h, "POST", "/flush", "", "").Code == http.StatusNoContent, t)
+	Assert(cache.Size() == 0, t)
+	Assert(doHTTP(h, "GET", "/flush", "", "").Code == http.StatusMethodNotAllowed, t)
+}
+
+// the handler works behind a real server too
+func TestHTTPHandler_Server(t *testing.T) {
+	srv := httptest.NewServer(NewHTTPHandler(NewLRUCache(10), 10))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("PUT", srv.URL+"/keys/k", strings.NewReader("v"))
+	req.Header.Set("Content-Type", "text/plain")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	resp, err = http.Get(srv.URL + "/keys/k")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	Assert(string(body) == "v", t)
+}
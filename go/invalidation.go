@@ -0,0 +1,292 @@
+package lru
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+)
+
+// 一条失效消息
+type Invalidation struct {
+	// id of the publishing cache
+	Source string
+
+	// per source sequence number, starts at 1, a gap means messages were lost
+	Seq uint64
+
+	// drop every key, Key is unused
+	Purge bool
+
+	// the encoded key
+	Key []byte
+}
+
+// 广播失效消息的总线
+type Bus interface {
+	// send msg to every subscriber, including the ones in this process
+	Publish(msg Invalidation) error
+
+	// call fn for every message until cancel is called
+	Subscribe(fn func(Invalidation)) (cancel func())
+
+	Close() error
+}
+
+// 多个实例之间同步失效的缓存
+type InvalidatingCache interface {
+	LRUCache
+
+	// drop every key here and on every other subscribed cache
+	InvalidateAll()
+
+	// number of purges caused by lost messages or InvalidateAll
+	Purges() int64
+
+	// the first publish or encoding error
+	Err() error
+
+	// unsubscribe from the bus, the bus itself is not closed
+	Close() error
+}
+
+type InvalidationOptions struct {
+	// id of this cache on the bus, default is random
+	ID string
+
+	// codec for keys on the bus, default is GobCodec
+	Codec Codec
+}
+
+/**
+Add和Remove之后把key发到总线上，其他实例收到后删掉自己的副本
+每个实例的消息带递增的序号，收到的序号不连续说明丢了消息，
+不知道哪些key过期了，只能清空整个缓存
+*/
+type invalidatingCache struct {
+	cache  LRUCache
+	cap    int
+	bus    Bus
+	codec  Codec
+	id     string
+	sendMu sync.Mutex // 按序号的顺序发布
+	seq    uint64
+	cancel func()
+	purges atomic.Int64
+
+	mu   sync.Mutex
+	last map[string]uint64 // 每个来源收到的最后一个序号
+	err  error
+}
+
+/**
+创建一个订阅了bus的缓存
+cap: 本地缓存的容量
+*/
+func NewInvalidatingCache(cap int, bus Bus, opts *InvalidationOptions) InvalidatingCache {
+	if opts == nil {
+		opts = &InvalidationOptions{}
+	}
+	c := &invalidatingCache{
+		cache: NewLRUCache(cap),
+		cap:   cap,
+		bus:   bus,
+		codec: opts.Codec,
+		id:    opts.ID,
+		last:  make(map[string]uint64),
+	}
+	if c.codec == nil {
+		c.codec = GobCodec
+	}
+	if c.id == "" {
+		var b [8]byte
+		rand.Read(b[:])
+		c.id = hex.EncodeToString(b[:])
+	}
+	c.cancel = bus.Subscribe(c.receive)
+	return c
+}
+
+// only clears the local cache, other caches are not told
+func (c *invalidatingCache) Create(cap int) {
+	c.mu.Lock()
+	c.cap = cap
+	c.mu.Unlock()
+	c.cache.Create(cap)
+}
+
+func (c *invalidatingCache) Add(k lruKey, v lruValue) {
+	c.cache.Add(k, v)
+	c.publish(k)
+}
+
+func (c *invalidatingCache) Size() int {
+	return c.cache.Size()
+}
+
+func (c *invalidatingCache) Find(k lruKey) lruValue {
+	return c.cache.Find(k)
+}
+
+func (c *invalidatingCache) Remove(k lruKey) lruValue {
+	v := c.cache.Remove(k)
+	c.publish(k)
+	return v
+}
+
+func (c *invalidatingCache) Iterator(reverse bool) *Iterator {
+	return c.cache.Iterator(reverse)
+}
+
+func (c *invalidatingCache) Iter(reverse bool) <-chan lruPair {
+	return c.cache.Iter(reverse)
+}
+
+func (c *invalidatingCache) InvalidateAll() {
+	c.purge()
+	c.send(Invalidation{Purge: true})
+}
+
+func (c *invalidatingCache) Purges() int64 {
+	return c.purges.Load()
+}
+
+func (c *invalidatingCache) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *invalidatingCache) Close() error {
+	c.cancel()
+	return nil
+}
+
+// 发布一个key的失效，key编码失败时让别人全部清空
+func (c *invalidatingCache) publish(k lruKey) {
+	data, err := c.codec.Marshal(k)
+	if err != nil {
+		c.fail(err)
+		c.send(Invalidation{Purge: true})
+		return
+	}
+	c.send(Invalidation{Key: data})
+}
+
+// 发送失败也要占用序号，这样对方能发现丢了消息
+func (c *invalidatingCache) send(msg Invalidation) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	c.seq++
+	msg.Source = c.id
+	msg.Seq = c.seq
+	c.fail(c.bus.Publish(msg))
+}
+
+func (c *invalidatingCache) receive(msg Invalidation) {
+	if msg.Source == c.id {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 没见过的来源当作上一个序号是0，第一条消息不是1说明前面的丢了
+	// 后加入的节点第一次收到时也会清空一次，多清空不会出错
+	last := c.last[msg.Source]
+	c.last[msg.Source] = msg.Seq
+	if msg.Purge || msg.Seq != last+1 {
+		c.purgeLocked()
+		return
+	}
+	k, err := c.codec.Unmarshal(msg.Key)
+	if err != nil {
+		c.purgeLocked()
+		return
+	}
+	c.cache.Remove(k)
+}
+
+func (c *invalidatingCache) purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purgeLocked()
+}
+
+func (c *invalidatingCache) purgeLocked() {
+	c.purges.Add(1)
+	c.cache.Create(c.cap)
+}
+
+func (c *invalidatingCache) fail(err error) {
+	if err == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+}
+
+// 总线的订阅者列表
+type subscribers struct {
+	subMu  sync.RWMutex
+	subs   map[int]func(Invalidation)
+	nextID int
+}
+
+func (s *subscribers) Subscribe(fn func(Invalidation)) func() {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	if s.subs == nil {
+		s.subs = make(map[int]func(Invalidation))
+	}
+	id := s.nextID
+	s.nextID++
+	s.subs[id] = fn
+	return func() {
+		s.subMu.Lock()
+		defer s.subMu.Unlock()
+		delete(s.subs, id)
+	}
+}
+
+// 在锁外调用订阅者，订阅者里可以再Subscribe或者cancel
+func (s *subscribers) deliver(msg Invalidation) {
+	s.subMu.RLock()
+	fns := make([]func(Invalidation), 0, len(s.subs))
+	for _, fn := range s.subs {
+		fns = append(fns, fn)
+	}
+	s.subMu.RUnlock()
+	for _, fn := range fns {
+		fn(msg)
+	}
+}
+
+func (s *subscribers) clear() {
+	s.subMu.Lock()
+	defer s.subMu.Unlock()
+	s.subs = nil
+}
+
+/**
+进程内的总线
+Publish同步调用所有订阅者
+*/
+type MemoryBus struct {
+	subscribers
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{}
+}
+
+func (b *MemoryBus) Publish(msg Invalidation) error {
+	b.deliver(msg)
+	return nil
+}
+
+func (b *MemoryBus) Close() error {
+	b.clear()
+	return nil
+}
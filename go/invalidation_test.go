@@ -0,0 +1,204 @@
+package lru
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInvalidatingCache_MemoryBus(t *testing.T) {
+	bus := NewMemoryBus()
+	a := NewInvalidatingCache(10, bus, &InvalidationOptions{ID: "a"})
+	b := NewInvalidatingCache(10, bus, &InvalidationOptions{ID: "b"})
+
+	b.Add("k", "old")
+	b.Add(1, 1)
+	a.Add("k", "new") // b drops its stale copy
+	Assert(a.Find("k") == "new", t)
+	Assert(b.Find("k") == nil, t)
+
+	a.Remove(1)
+	Assert(b.Find(1) == nil, t)
+	Assert(b.Size() == 0, t)
+
+	// a cache does not invalidate itself
+	a.Add("x", "y")
+	Assert(a.Find("x") == "y", t)
+
+	b.Add("z", "z")
+	a.InvalidateAll()
+	Assert(a.Size() == 0 && b.Size() == 0, t)
+	Assert(b.Purges() == 1, t)
+
+	// a closed cache stops listening
+	b.Add("z", "z")
+	b.Close()
+	a.Remove("z")
+	Assert(b.Find("z") == "z", t)
+	Assert(a.Err() == nil, t)
+}
+
+func TestInvalidatingCache_Gap(t *testing.T) {
+	bus := NewMemoryBus()
+	c := NewInvalidatingCache(10, bus, &InvalidationOptions{ID: "c"})
+	key := func(k string) []byte {
+		data, _ := GobCodec.Marshal(k)
+		return data
+	}
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	// a source starts at 1
+	bus.Publish(Invalidation{Source: "x", Seq: 1, Key: key("a")})
+	Assert(c.Find("a") == nil && c.Find("b") == 2, t)
+	Assert(c.Purges() == 0, t)
+
+	bus.Publish(Invalidation{Source: "x", Seq: 2, Key: key("nope")})
+	Assert(c.Purges() == 0, t)
+
+	// message 3 was lost, nothing can be trusted anymore
+	bus.Publish(Invalidation{Source: "x", Seq: 4, Key: key("nope")})
+	Assert(c.Purges() == 1, t)
+	Assert(c.Size() == 0, t)
+
+	// numbering continues from the last message
+	c.Add("b", 2)
+	bus.Publish(Invalidation{Source: "x", Seq: 5, Key: key("nope")})
+	Assert(c.Purges() == 1 && c.Find("b") == 2, t)
+
+	// the first messages of a new source were lost
+	bus.Publish(Invalidation{Source: "y", Seq: 3, Key: key("nope")})
+	Assert(c.Purges() == 2 && c.Size() == 0, t)
+}
+
+func TestBusFrame(t *testing.T) {
+	for _, msg := range []Invalidation{
+		{Source: "node-1", Seq: 1, Key: []byte("key")},
+		{Source: "", Seq: 1 << 40, Purge: true},
+	} {
+		got, err := readBusFrame(bufio.NewReader(bytes.NewReader(encodeBusFrame(msg))))
+		Assert(err == nil, t)
+		Assert(got.Source == msg.Source && got.Seq == msg.Seq && got.Purge == msg.Purge, t)
+		Assert(bytes.Equal(got.Key, msg.Key), t)
+	}
+	_, err := readBusFrame(bufio.NewReader(bytes.NewReader([]byte{3, 9, 'a', 'b'})))
+	Assert(err == errBusFrame, t)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// the last sequence number c has seen from source
+func lastSeq(c InvalidatingCache, source string) uint64 {
+	ic := c.(*invalidatingCache)
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	return ic.last[source]
+}
+
+func TestTCPBus_Loopback(t *testing.T) {
+	busA, err := NewTCPBus("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer busA.Close()
+	busB, err := NewTCPBus("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	busA.SetPeers(busA.Addr(), busB.Addr())
+	busB.SetPeers(busA.Addr(), busB.Addr())
+
+	a := NewInvalidatingCache(10, busA, &InvalidationOptions{ID: "a"})
+	b := NewInvalidatingCache(10, busB, &InvalidationOptions{ID: "b"})
+
+	b.Add("k", "old")
+	b.Add("k2", "old")
+	// b's own invalidations must reach a before a writes
+	waitFor(t, func() bool { return lastSeq(a, "b") == 2 })
+	a.Add("k", "new")
+	waitFor(t, func() bool { return b.Find("k") == nil })
+	Assert(a.Find("k") == "new", t)
+	b.Add("x", 1)
+	a.Remove("k2")
+	waitFor(t, func() bool { return b.Find("k2") == nil })
+	Assert(b.Find("x") == 1, t)
+
+	// messages b misses show up as a gap and b purges
+	busA.SetPeers()
+	a.Remove("lost")
+	busA.SetPeers(busB.Addr())
+	a.Remove("z")
+	waitFor(t, func() bool { return b.Purges() == 1 })
+	Assert(b.Find("x") == nil, t)
+	b.Close()
+	busB.Close()
+}
+
+func TestTCPBus_PeerDown(t *testing.T) {
+	down, err := NewTCPBus("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down.Close()
+	bus, err := NewTCPBus("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	bus.SetPeers(down.Addr())
+
+	c := NewInvalidatingCache(10, bus, nil)
+	// the dial error is reported by a later write
+	start := time.Now()
+	waitFor(t, func() bool {
+		c.Add("k", "v")
+		return c.Err() != nil
+	})
+	Assert(time.Since(start) < busDialTimeout, t)
+	// the local cache still works
+	Assert(c.Find("k") == "v", t)
+}
+
+// a peer that stops reading does not block writes, its messages are dropped
+func TestTCPBus_SlowPeer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			time.Sleep(5 * time.Second) // never reads
+		}
+	}()
+	bus, err := NewTCPBus("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bus.Close()
+	bus.SetPeers(ln.Addr().String())
+
+	c := NewInvalidatingCache(10, bus, nil)
+	key := strings.Repeat("k", 4096)
+	start := time.Now()
+	for i := 0; i < 3000; i++ {
+		c.Add(key+strconv.Itoa(i), i)
+	}
+	Assert(time.Since(start) < busDialTimeout/2, t)
+	Assert(c.Err() == ErrBusDropped, t)
+}
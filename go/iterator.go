@@ -26,3 +26,21 @@ func newIterator(cap int) (*Iterator, chan<- lruPair, <-chan struct{}) {
 		stop: stopChan,
 	}, itemChan, stopChan
 }
+
+// 从一个已经排好序的slice创建迭代器
+// channel的容量等于slice的长度，所以写入不会阻塞，也不需要协程
+func newSliceIterator(pairs []lruPair) *Iterator {
+	iterator, ch, _ := newIterator(len(pairs))
+	for _, p := range pairs {
+		ch <- p
+	}
+	close(ch)
+	return iterator
+}
+
+// 原地翻转
+func reversePairs(pairs []lruPair) {
+	for i, j := 0, len(pairs)-1; i < j; i, j = i+1, j-1 {
+		pairs[i], pairs[j] = pairs[j], pairs[i]
+	}
+}
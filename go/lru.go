@@ -1,5 +1,7 @@
 package lru
 
+import "iter"
+
 // 值的类型 类似void*(clang)
 type lruValue interface{}
 
@@ -48,3 +50,121 @@ func NewThreadUnsafeLRUCache(cap int) LRUCache {
 	lru.Create(cap)
 	return lru
 }
+
+// new a thread safe lru cache whose Find never takes a lock
+// recency is recorded in buffers and applied in batches, so eviction order is approximate
+func NewConcurrentLRUCache(cap int) LRUCache {
+	lru := newConcurrentLRU()
+	lru.Create(cap)
+	return lru
+}
+
+// new a thread safe GreedyDual-Size cache
+// cap is the total size budget of all entries
+func NewGDSCache(cap int) GDSCache {
+	gds := newThreadSafeGDS()
+	gds.Create(cap)
+	return gds
+}
+
+// new a thread unsafe GreedyDual-Size cache
+func NewThreadUnsafeGDSCache(cap int) GDSCache {
+	gds := newThreadUnsafeGDS()
+	gds.Create(cap)
+	return gds
+}
+
+// new a thread safe approximate lru cache (like redis allkeys-lru)
+// samples is the number of random entries checked on each eviction, 0 means 5
+func NewSampledLRUCache(cap, samples int) LRUCache {
+	lru := newThreadSafeSampledLRU(samples)
+	lru.Create(cap)
+	return lru
+}
+
+// new a thread unsafe approximate lru cache
+func NewThreadUnsafeSampledLRUCache(cap, samples int) LRUCache {
+	lru := newThreadUnsafeSampledLRU(samples)
+	lru.Create(cap)
+	return lru
+}
+
+// a cache that reports entries evicted because it is full
+// NewLRUCache and NewThreadUnsafeLRUCache implement it
+type Evictable interface {
+	// fn is called with every entry evicted from the head, or dropped by RemoveIf and EvictWhile
+	SetOnEvict(fn func(k, v interface{}))
+}
+
+// a cache that recycles its list nodes
+// NewLRUCache and NewThreadUnsafeLRUCache implement it
+type Pooled interface {
+	// keep at most n free nodes for reuse, the default is 16
+	SetPoolSize(n int)
+}
+
+// a cache that can be walked without goroutines or channels
+// NewLRUCache and NewThreadUnsafeLRUCache implement it
+type Ranger interface {
+	// call fn for every entry, same order as Iterator(reverse), stop when fn returns false
+	// fn must not change the cache, use Cursor for that
+	Range(reverse bool, fn func(k, v interface{}) bool)
+
+	// a pull style cursor, same order as Iterator(reverse)
+	Cursor(reverse bool) *Cursor
+
+	// range over func, newest first (tail.prev to head.next), like Iterator(false)
+	// built on Cursor, so the loop body may call and change the cache
+	// entries the body adds or moves (Add, Find) are not visited again, see Cursor
+	All() iter.Seq2[interface{}, interface{}]
+
+	// oldest first (head.next to tail.prev), like Iterator(true)
+	Backward() iter.Seq2[interface{}, interface{}]
+
+	// the keys of All
+	Keys() iter.Seq[interface{}]
+
+	// the values of All
+	Values() iter.Seq[interface{}]
+
+	// a point in time copy of every entry, read it at leisure while writers go on
+	// taking it is an O(n) copy under the read lock, like Iterator, not a copy-on-write capture
+	Snapshot() *Snapshot
+
+	// the entries of All for which pred returns true
+	// pred runs over the whole list in one pass under one read lock, so it must not call the cache
+	// the matches are copied first, so the loop body may call and change the cache
+	Filter(pred func(k, v interface{}) bool) iter.Seq2[interface{}, interface{}]
+}
+
+// a cache that can drop entries in bulk, in one pass under one lock
+// NewLRUCache and NewThreadUnsafeLRUCache implement it
+type Pruner interface {
+	// remove every entry fn returns true for, return how many
+	// fn must not call the cache
+	RemoveIf(fn func(k, v interface{}) bool) int
+
+	// evict from the head (oldest) while pred returns true, return how many
+	// pred must not call the cache
+	EvictWhile(pred func(k, v interface{}) bool) int
+}
+
+// a key and its value, for batch operations
+type Entry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// a cache that runs a batch of operations under one lock
+// NewLRUCache, NewThreadUnsafeLRUCache and NewConcurrentLRUCache implement it
+type Batcher interface {
+	// add in order, the last entry ends up the newest
+	AddAll(entries []Entry)
+
+	// find in order, the last hit ends up the newest
+	// values[i] is the value of keys[i], nil when not found
+	FindAll(keys []interface{}) []interface{}
+
+	// remove in order, values[i] is the removed value of keys[i] or nil
+	RemoveAll(keys []interface{}) []interface{}
+}
@@ -295,3 +295,53 @@ func TestThreadUnsafeLRU_Iterator2(t *testing.T) {
 		c <- p
 	}
 }
+
+func TestThreadUnsafeLRU_Pool(t *testing.T) {
+	a := NewThreadUnsafeLRUCache(100)
+	c := a.(*threadUnsafeLRU)
+	for i := 0; i < 100; i++ {
+		a.Add(i, i)
+	}
+	Assert(c.nfree == 0, t)
+
+	// removed nodes are kept up to the pool size
+	for i := 0; i < 50; i++ {
+		a.Remove(i)
+	}
+	Assert(c.nfree == defaultPoolSize, t)
+	a.(Pooled).SetPoolSize(4)
+	Assert(c.nfree == 4, t)
+	for i := 0; i < 3; i++ {
+		a.Add(i, i)
+	}
+	Assert(c.nfree == 1, t)
+
+	// pooled nodes are reused
+	free := c.free
+	a.Add(1000, 1000)
+	Assert(c.dict[1000] == free && c.nfree == 0, t)
+
+	a.(Pooled).SetPoolSize(0)
+	a.Remove(1000)
+	Assert(c.nfree == 0 && c.free == nil, t)
+	Assert(a.Size() == 53, t)
+	Assert(a.Find(99) == 99 && a.Find(0) == 0, t)
+}
+
+// a full cache recycles the evicted node, so Add does not allocate
+func TestThreadUnsafeLRU_AddAllocs(t *testing.T) {
+	a := NewThreadUnsafeLRUCache(100)
+	keys := make([]interface{}, 1000)
+	for i := range keys {
+		keys[i] = i + 1000
+	}
+	for i := 0; i < 1000; i++ {
+		a.Add(keys[i], keys[i])
+	}
+	i := 0
+	allocs := testing.AllocsPerRun(1000, func() {
+		a.Add(keys[i%len(keys)], keys[i%len(keys)])
+		i++
+	})
+	Assert(allocs == 0, t)
+}
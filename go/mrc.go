@@ -0,0 +1,226 @@
+package lru
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+)
+
+// 哈希空间的大小，采样时 hash(key) mod shardsModulus < rate * shardsModulus
+const shardsModulus = 1 << 24
+
+/**
+Miss Ratio Curve 估算 (SHARDS)
+按key的哈希做空间采样，只跟踪被采样的key的重用距离(reuse distance)
+重用距离 = 两次访问同一个key之间访问过的不同key的数量
+容量为C的LRU命中 当且仅当 重用距离 < C，所以一遍就能算出所有容量的命中率
+采样率为R时，采样到的重用距离 / R 就是真实的重用距离
+
+Waldspurger et al. "Efficient MRC Construction with SHARDS" (FAST '15)
+*/
+type MRC struct {
+	threshold uint64         // 采样阈值
+	rate      float64        // 采样率
+	last      map[lruKey]int // 被采样的key -> 最后访问时间
+	tree      []int          // 树状数组，时间t上有没有key最后一次在t被访问
+	clock     int            // 被采样的访问的逻辑时钟
+	hist      []float64      // 重用距离(采样单位)的直方图
+	cold      float64        // 第一次访问(冷miss)的次数
+	sampled   float64        // 被采样的访问次数
+	total     float64        // 所有的访问次数
+	sync.Mutex
+}
+
+/**
+创建估算器
+rate: 采样率 (0, 1]，1表示精确计算；10亿级的trace用0.001就够了
+*/
+func NewMRC(rate float64) *MRC {
+	if rate <= 0 || rate > 1 {
+		rate = 1
+	}
+	return &MRC{
+		threshold: uint64(rate * shardsModulus),
+		rate:      rate,
+		last:      make(map[lruKey]int),
+		tree:      make([]int, 1025),
+	}
+}
+
+/**
+记录一次访问
+
+cost: 没被采样O(1)，被采样O(log n)
+*/
+func (m *MRC) Record(k lruKey) {
+	m.Lock()
+	defer m.Unlock()
+	m.total++
+	if hashKey(k)%shardsModulus >= m.threshold {
+		return
+	}
+	m.sampled++
+	if m.clock+1 >= len(m.tree) {
+		m.compact()
+	}
+	m.clock++
+	if prev, ok := m.last[k]; ok {
+		// prev之后还有标记的，就是中间访问过的不同的key
+		d := m.sum(m.clock-1) - m.sum(prev)
+		for len(m.hist) <= d {
+			m.hist = append(m.hist, 0)
+		}
+		m.hist[d]++
+		m.update(prev, -1)
+	} else {
+		m.cold++
+	}
+	m.last[k] = m.clock
+	m.update(m.clock, 1)
+}
+
+/**
+预测容量为cap的LRU的命中率
+*/
+func (m *MRC) HitRatio(cap int) float64 {
+	m.Lock()
+	defer m.Unlock()
+	expected := m.total * m.rate
+	if expected == 0 {
+		return 0
+	}
+	// SHARDS_adj: 实际采样数和期望采样数的差，补到距离最小的桶里
+	hits := expected - m.sampled
+	limit := float64(cap) * m.rate
+	for d, n := range m.hist {
+		if float64(d) >= limit {
+			break
+		}
+		hits += n
+	}
+	if hits < 0 {
+		hits = 0
+	}
+	ratio := hits / expected
+	if ratio > 1 {
+		ratio = 1
+	}
+	return ratio
+}
+
+/**
+一组容量对应的命中率
+*/
+func (m *MRC) Curve(caps []int) []float64 {
+	ratios := make([]float64, len(caps))
+	for i, c := range caps {
+		ratios[i] = m.HitRatio(c)
+	}
+	return ratios
+}
+
+// 访问次数
+func (m *MRC) Total() int {
+	m.Lock()
+	defer m.Unlock()
+	return int(m.total)
+}
+
+// 树状数组: [1, t]的和
+func (m *MRC) sum(t int) int {
+	s := 0
+	for ; t > 0; t -= t & -t {
+		s += m.tree[t]
+	}
+	return s
+}
+
+// 树状数组: t上加d
+func (m *MRC) update(t, d int) {
+	for ; t < len(m.tree); t += t & -t {
+		m.tree[t] += d
+	}
+}
+
+/**
+时钟用完了，按最后访问时间重新编号
+只有还活着的key占位置，所以树状数组的大小 = 2 * 被采样的不同key的数量
+*/
+func (m *MRC) compact() {
+	keys := make([]lruKey, 0, len(m.last))
+	for k := range m.last {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return m.last[keys[i]] < m.last[keys[j]]
+	})
+	size := 2*len(keys) + 1
+	if size < 1025 {
+		size = 1025
+	}
+	m.tree = make([]int, size)
+	for i, k := range keys {
+		m.last[k] = i + 1
+		m.update(i+1, 1)
+	}
+	m.clock = len(keys)
+}
+
+/**
+在cache上挂一个MRC
+每次Find都记录一次访问
+*/
+func WithMRC(cache LRUCache, m *MRC) LRUCache {
+	return &mrcCache{cache, m}
+}
+
+type mrcCache struct {
+	LRUCache
+	mrc *MRC
+}
+
+func (cache *mrcCache) Find(k lruKey) lruValue {
+	cache.mrc.Record(k)
+	return cache.LRUCache.Find(k)
+}
+
+/**
+key的哈希
+常见类型直接算，其他类型用%#v的结果算
+*/
+func hashKey(k lruKey) uint64 {
+	switch v := k.(type) {
+	case string:
+		return fnvString(v)
+	case int:
+		return mix64(uint64(v))
+	case int32:
+		return mix64(uint64(v))
+	case int64:
+		return mix64(uint64(v))
+	case uint:
+		return mix64(uint64(v))
+	case uint32:
+		return mix64(uint64(v))
+	case uint64:
+		return mix64(v)
+	}
+	return fnvString(fmt.Sprintf("%#v", k))
+}
+
+func fnvString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return mix64(h.Sum64())
+}
+
+// splitmix64 的finalizer，让连续的整数也均匀分布
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
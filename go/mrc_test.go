@@ -0,0 +1,75 @@
+package lru
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func zipfTrace(n int, keys uint64) []interface{} {
+	z := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, keys)
+	trace := make([]interface{}, n)
+	for i := range trace {
+		trace[i] = int(z.Uint64())
+	}
+	return trace
+}
+
+// with rate 1 the estimate is the exact lru hit ratio
+func TestMRC_Exact(t *testing.T) {
+	trace := zipfTrace(20000, 5000)
+	m := NewMRC(1)
+	for _, k := range trace {
+		m.Record(k)
+	}
+	Assert(m.Total() == len(trace), t)
+
+	for _, cap := range []int{1, 10, 100, 1000} {
+		want := Simulate(NewThreadUnsafeLRUCache(cap), trace).HitRatio()
+		got := m.HitRatio(cap)
+		if math.Abs(want-got) > 1e-9 {
+			t.Errorf("cap %d: want %f, got %f", cap, want, got)
+		}
+	}
+}
+
+func TestMRC_Sampled(t *testing.T) {
+	trace := zipfTrace(200000, 100000)
+	m := NewMRC(0.1)
+	for _, k := range trace {
+		m.Record(k)
+	}
+
+	caps := []int{100, 1000, 10000}
+	curve := m.Curve(caps)
+	for i, cap := range caps {
+		want := Simulate(NewThreadUnsafeLRUCache(cap), trace).HitRatio()
+		if math.Abs(want-curve[i]) > 0.05 {
+			t.Errorf("cap %d: want %f, got %f", cap, want, curve[i])
+		}
+	}
+}
+
+func TestMRC_Compact(t *testing.T) {
+	m := NewMRC(1)
+	// far more accesses than the initial tree size
+	for i := 0; i < 10000; i++ {
+		m.Record(i % 3)
+	}
+	Assert(m.HitRatio(3) > 0.99, t)
+	Assert(m.HitRatio(2) == 0, t)
+}
+
+func TestWithMRC(t *testing.T) {
+	m := NewMRC(1)
+	a := WithMRC(NewLRUCache(10), m)
+
+	a.Add(1, 1)
+	Assert(a.Find(1) == 1, t)
+	Assert(a.Find(1) == 1, t)
+	Assert(a.Find(2) == nil, t)
+	Assert(a.Size() == 1, t)
+
+	Assert(m.Total() == 3, t)
+	Assert(m.HitRatio(10) == 1.0/3.0, t)
+}
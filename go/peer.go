@@ -0,0 +1,330 @@
+package lru
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fn panic时，等待同一个key的其他调用拿到这个错误
+var errFlightPanic = errors.New("lru: load panicked")
+
+// 数据的来源，只在key的owner上调用
+type Getter interface {
+	// load a key, nil value means the key does not exist
+	Get(key string) (interface{}, error)
+}
+
+type GetterFunc func(key string) (interface{}, error)
+
+func (f GetterFunc) Get(key string) (interface{}, error) {
+	return f(key)
+}
+
+// 从其他节点取数据的方式
+type PeerTransport interface {
+	// fetch the encoded value of key from peer, nil data and nil error means not found
+	Fetch(peer, key string) ([]byte, error)
+}
+
+type PeerOptions struct {
+	// capacity of the cache for keys this peer owns, default is 1024
+	Cap int
+
+	// capacity of the cache for hot keys owned by other peers, default is Cap/8
+	HotCap int
+
+	// virtual nodes per peer on the hash ring, default is 50
+	Replicas int
+
+	// how to reach other peers, default is an HTTPTransport
+	Transport PeerTransport
+
+	// codec for values sent between peers, default is GobCodec
+	Codec Codec
+}
+
+type PeerStats struct {
+	Gets       int64 // Get calls
+	MainHits   int64 // hits in the cache of owned keys
+	HotHits    int64 // hits in the hot cache
+	Loads      int64 // loads from the getter
+	PeerLoads  int64 // fetches from other peers
+	PeerErrors int64 // failed fetches, served by the local getter instead
+}
+
+/**
+groupcache风格的分布式缓存
+每个key通过一致性哈希有一个owner，只有owner从Getter加载并缓存在main里
+其他节点向owner取，取到的结果缓存在一个小的hot里，热点key不用每次都走网络
+同一个key的并发加载只做一次
+PeerGroup本身是一个http.Handler，给其他节点的HTTPTransport用
+*/
+type PeerGroup struct {
+	self      string
+	getter    Getter
+	transport PeerTransport
+	codec     Codec
+	main      LRUCache
+	hot       LRUCache
+	hotCap    int
+
+	mu   sync.RWMutex
+	ring *HashRing
+	reps int
+
+	flightMu sync.Mutex
+	flights  map[string]*flight
+
+	gets, mainHits, hotHits, loads, peerLoads, peerErrors atomic.Int64
+}
+
+// 一次正在进行的加载
+type flight struct {
+	wg  sync.WaitGroup
+	v   interface{}
+	err error
+}
+
+// 没有设置Cap时owner缓存的容量
+const defaultPeerCap = 1024
+
+/**
+创建分布式缓存的一个节点
+self: 本节点的地址，和SetPeers里用的一样，对于HTTPTransport是"http://host:port"
+*/
+func NewPeerGroup(self string, getter Getter, opts *PeerOptions) *PeerGroup {
+	if opts == nil {
+		opts = &PeerOptions{}
+	}
+	cap := opts.Cap
+	if cap <= 0 {
+		cap = defaultPeerCap
+	}
+	hotCap := opts.HotCap
+	if hotCap <= 0 {
+		hotCap = cap / 8
+		if hotCap < 1 {
+			hotCap = 1
+		}
+	}
+	g := &PeerGroup{
+		self:      self,
+		getter:    getter,
+		transport: opts.Transport,
+		codec:     opts.Codec,
+		main:      NewLRUCache(cap),
+		hot:       NewLRUCache(hotCap),
+		hotCap:    hotCap,
+		reps:      opts.Replicas,
+		ring:      NewHashRing(opts.Replicas),
+		flights:   make(map[string]*flight),
+	}
+	if g.transport == nil {
+		g.transport = &HTTPTransport{}
+	}
+	if g.codec == nil {
+		g.codec = GobCodec
+	}
+	g.ring.Add(self)
+	return g
+}
+
+// replace the peer list, self is always a member
+func (g *PeerGroup) SetPeers(peers ...string) {
+	ring := NewHashRing(g.reps)
+	ring.Add(g.self)
+	for _, p := range peers {
+		if p != g.self {
+			ring.Add(p)
+		}
+	}
+	g.mu.Lock()
+	g.ring = ring
+	g.mu.Unlock()
+	// owner变了，别人的key不能再当成自己的
+	g.hot.Create(g.hotCap)
+}
+
+// the peer that owns key
+func (g *PeerGroup) Owner(key string) string {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.ring.Get(key)
+}
+
+/**
+取一个key
+先查本地的两个缓存，没命中时owner是自己就从Getter加载，否则向owner取
+向owner取失败时退回本地Getter，结果不缓存
+*/
+func (g *PeerGroup) Get(key string) (interface{}, error) {
+	g.gets.Add(1)
+	if v := g.main.Find(key); v != nil {
+		g.mainHits.Add(1)
+		return v, nil
+	}
+	if v := g.hot.Find(key); v != nil {
+		g.hotHits.Add(1)
+		return v, nil
+	}
+	return g.do(key, func() (interface{}, error) {
+		owner := g.Owner(key)
+		if owner == g.self {
+			return g.loadLocal(key)
+		}
+		v, err := g.fetch(owner, key)
+		if err != nil {
+			g.peerErrors.Add(1)
+			g.loads.Add(1)
+			return g.getter.Get(key)
+		}
+		if v != nil {
+			g.hot.Add(key, v)
+		}
+		return v, nil
+	})
+}
+
+// drop key from the local caches, the owner and other peers keep their copies
+func (g *PeerGroup) Remove(key string) {
+	g.main.Remove(key)
+	g.hot.Remove(key)
+}
+
+func (g *PeerGroup) Stats() PeerStats {
+	return PeerStats{
+		Gets:       g.gets.Load(),
+		MainHits:   g.mainHits.Load(),
+		HotHits:    g.hotHits.Load(),
+		Loads:      g.loads.Load(),
+		PeerLoads:  g.peerLoads.Load(),
+		PeerErrors: g.peerErrors.Load(),
+	}
+}
+
+/**
+响应其他节点的HTTPTransport
+GET ?key=k 返回编码后的值，不存在返回404
+请求到了这里就说明对方认为自己是owner，即使自己的环不这么认为也在本地加载，避免转发成环
+*/
+func (g *PeerGroup) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	v := g.main.Find(key)
+	if v != nil {
+		g.mainHits.Add(1)
+	} else {
+		var err error
+		v, err = g.do(key, func() (interface{}, error) { return g.loadLocal(key) })
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	if v == nil {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := g.codec.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(data)
+}
+
+// 从Getter加载并缓存在main里
+func (g *PeerGroup) loadLocal(key string) (interface{}, error) {
+	g.loads.Add(1)
+	v, err := g.getter.Get(key)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	g.main.Add(key, v)
+	return v, nil
+}
+
+func (g *PeerGroup) fetch(peer, key string) (interface{}, error) {
+	g.peerLoads.Add(1)
+	data, err := g.transport.Fetch(peer, key)
+	if err != nil || data == nil {
+		return nil, err
+	}
+	return g.codec.Unmarshal(data)
+}
+
+// 同一个key同时只执行一次fn，其他调用等待并共享结果
+func (g *PeerGroup) do(key string, fn func() (interface{}, error)) (interface{}, error) {
+	g.flightMu.Lock()
+	if f, ok := g.flights[key]; ok {
+		g.flightMu.Unlock()
+		f.wg.Wait()
+		return f.v, f.err
+	}
+	f := &flight{}
+	f.wg.Add(1)
+	g.flights[key] = f
+	g.flightMu.Unlock()
+
+	// fn panic也要唤醒等待的调用，并让这个key可以重新加载
+	defer func() {
+		g.flightMu.Lock()
+		delete(g.flights, key)
+		g.flightMu.Unlock()
+		f.wg.Done()
+	}()
+	f.err = errFlightPanic
+	f.v, f.err = fn()
+	return f.v, f.err
+}
+
+const defaultPeerBasePath = "/_lrupeer/"
+
+// 没有设置Client时用的，一个卡住的peer最多让调用者等这么久
+var defaultPeerClient = &http.Client{Timeout: 5 * time.Second}
+
+/**
+基于http的PeerTransport
+peer是"http://host:port"，PeerGroup挂在peer的BasePath上
+*/
+type HTTPTransport struct {
+	// path the PeerGroup is served on, default is "/_lrupeer/"
+	BasePath string
+
+	// default is a client with a 5s timeout
+	Client *http.Client
+}
+
+func (t *HTTPTransport) Fetch(peer, key string) ([]byte, error) {
+	base := t.BasePath
+	if base == "" {
+		base = defaultPeerBasePath
+	}
+	client := t.Client
+	if client == nil {
+		client = defaultPeerClient
+	}
+	resp, err := client.Get(peer + base + "?key=" + url.QueryEscape(key))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return io.ReadAll(resp.Body)
+	case http.StatusNotFound:
+		return nil, nil
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	return nil, fmt.Errorf("lru: peer %s returned %s: %s", peer, resp.Status, msg)
+}
@@ -0,0 +1,254 @@
+package lru
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHashRing(t *testing.T) {
+	r := NewHashRing(100)
+	Assert(r.Get("k") == "", t)
+	r.Add("a", "b", "c")
+	Assert(r.Len() == 3, t)
+
+	owners := make(map[string]string)
+	counts := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		k := strconv.Itoa(i)
+		owners[k] = r.Get(k)
+		counts[owners[k]]++
+	}
+	// virtual nodes keep the split roughly even
+	for _, n := range counts {
+		Assert(n > 600 && n < 1400, t)
+	}
+
+	// removing a node only moves its own keys
+	r.Remove("b")
+	Assert(r.Len() == 2, t)
+	for k, owner := range owners {
+		if owner != "b" {
+			Assert(r.Get(k) == owner, t)
+		} else {
+			Assert(r.Get(k) != "b", t)
+		}
+	}
+}
+
+// three peers on loopback, each counting how often its getter runs
+func startPeers(t *testing.T, n int) ([]*PeerGroup, []*atomic.Int64) {
+	servers := make([]*httptest.Server, n)
+	handlers := make([]http.Handler, n)
+	urls := make([]string, n)
+	for i := range servers {
+		i := i
+		servers[i] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			handlers[i].ServeHTTP(w, r)
+		}))
+		t.Cleanup(servers[i].Close)
+		urls[i] = servers[i].URL
+	}
+	groups := make([]*PeerGroup, n)
+	loads := make([]*atomic.Int64, n)
+	for i := range groups {
+		counter := &atomic.Int64{}
+		loads[i] = counter
+		getter := GetterFunc(func(key string) (interface{}, error) {
+			counter.Add(1)
+			if key == "missing" {
+				return nil, nil
+			}
+			if key == "bad" {
+				return nil, errors.New("boom")
+			}
+			return "value:" + key, nil
+		})
+		groups[i] = NewPeerGroup(urls[i], getter, &PeerOptions{Cap: 100, HotCap: 100})
+		groups[i].SetPeers(urls...)
+		mux := http.NewServeMux()
+		mux.Handle(defaultPeerBasePath, groups[i])
+		handlers[i] = mux
+	}
+	return groups, loads
+}
+
+func TestPeerGroup_Loopback(t *testing.T) {
+	groups, loads := startPeers(t, 3)
+
+	// every peer agrees on the owner, and only the owner loads
+	for i := 0; i < 30; i++ {
+		key := "k" + strconv.Itoa(i)
+		for _, g := range groups {
+			v, err := g.Get(key)
+			Assert(err == nil && v == "value:"+key, t)
+		}
+	}
+	total := int64(0)
+	for _, l := range loads {
+		total += l.Load()
+	}
+	Assert(total == 30, t)
+
+	// remote results are cached as hot keys
+	var remote *PeerGroup
+	key := "k0"
+	for _, g := range groups {
+		if g.Owner(key) != g.self {
+			remote = g
+			break
+		}
+	}
+	before := remote.Stats()
+	v, _ := remote.Get(key)
+	Assert(v == "value:k0", t)
+	after := remote.Stats()
+	Assert(after.HotHits == before.HotHits+1, t)
+	Assert(after.PeerLoads == before.PeerLoads, t)
+
+	v, err := groups[0].Get("missing")
+	Assert(v == nil && err == nil, t)
+	for _, g := range groups {
+		_, err = g.Get("bad")
+		Assert(err != nil, t)
+	}
+}
+
+func TestPeerGroup_PeerDown(t *testing.T) {
+	var loads atomic.Int64
+	getter := GetterFunc(func(key string) (interface{}, error) {
+		loads.Add(1)
+		return key, nil
+	})
+	g := NewPeerGroup("http://self", getter, &PeerOptions{Cap: 10})
+	// a peer that refuses connections owns everything it can
+	dead := httptest.NewServer(http.NotFoundHandler())
+	dead.Close()
+	g.SetPeers("http://self", dead.URL)
+
+	for i := 0; i < 20; i++ {
+		k := strconv.Itoa(i)
+		v, err := g.Get(k)
+		Assert(err == nil && v == k, t)
+	}
+	Assert(loads.Load() == 20, t)
+	Assert(g.Stats().PeerErrors > 0, t)
+}
+
+type countingTransport struct {
+	calls atomic.Int64
+	block chan struct{}
+}
+
+func (c *countingTransport) Fetch(peer, key string) ([]byte, error) {
+	c.calls.Add(1)
+	<-c.block
+	return GobCodec.Marshal("v")
+}
+
+// concurrent misses for one key share a single fetch
+func TestPeerGroup_SingleFlight(t *testing.T) {
+	tr := &countingTransport{block: make(chan struct{})}
+	g := NewPeerGroup("self", GetterFunc(func(string) (interface{}, error) { return nil, nil }),
+		&PeerOptions{Cap: 10, Transport: tr})
+	g.SetPeers("other")
+	key := "k"
+	for i := 0; g.Owner(key) != "other"; i++ {
+		key = "k" + strconv.Itoa(i)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, _ := g.Get(key)
+			Assert(v == "v", t)
+		}()
+	}
+	// let every goroutine join the fetch in flight before releasing it
+	for tr.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(tr.block)
+	wg.Wait()
+	Assert(tr.calls.Load() == 1, t)
+}
+
+// nil options fall back to defaults instead of a zero capacity cache
+func TestPeerGroup_NilOptions(t *testing.T) {
+	g := NewPeerGroup("self", GetterFunc(func(k string) (interface{}, error) { return "v:" + k, nil }), nil)
+	v, err := g.Get("a")
+	Assert(err == nil && v == "v:a", t)
+	v, err = g.Get("a")
+	Assert(err == nil && v == "v:a", t)
+	Assert(g.Stats().MainHits == 1, t)
+}
+
+// a panicking load wakes the other callers and does not leave the key stuck
+func TestPeerGroup_LoadPanics(t *testing.T) {
+	var calls atomic.Int64
+	block := make(chan struct{})
+	g := NewPeerGroup("self", GetterFunc(func(k string) (interface{}, error) {
+		if calls.Add(1) == 1 {
+			<-block
+			panic("boom")
+		}
+		return "v", nil
+	}), nil)
+
+	go func() {
+		defer func() { recover() }()
+		g.Get("k")
+	}()
+	for calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	waiter := make(chan error)
+	go func() {
+		_, err := g.Get("k")
+		waiter <- err
+	}()
+	time.Sleep(20 * time.Millisecond) // let it join the flight
+	close(block)
+	select {
+	case err := <-waiter:
+		Assert(err != nil, t)
+	case <-time.After(time.Second):
+		t.Fatal("waiter stuck after a panic")
+	}
+	v, err := g.Get("k")
+	Assert(err == nil && v == "v", t)
+}
+
+// without a Client a hung peer fails after the default timeout
+func TestHTTPTransport_DefaultTimeout(t *testing.T) {
+	Assert(defaultPeerClient.Timeout > 0, t)
+	hung := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-hung
+	}))
+	defer srv.Close()
+	defer close(hung)
+
+	old := defaultPeerClient
+	defaultPeerClient = &http.Client{Timeout: 50 * time.Millisecond}
+	defer func() { defaultPeerClient = old }()
+	done := make(chan error)
+	go func() {
+		_, err := (&HTTPTransport{}).Fetch(srv.URL, "k")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		Assert(err != nil, t)
+	case <-time.After(time.Second):
+		t.Fatal("fetch from a hung peer did not time out")
+	}
+}
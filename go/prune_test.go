@@ -0,0 +1,77 @@
+package lru
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRemoveIf(t *testing.T) {
+	for _, a := range []LRUCache{NewLRUCache(10), NewThreadUnsafeLRUCache(10)} {
+		var evicted []interface{}
+		a.(Evictable).SetOnEvict(func(k, v interface{}) { evicted = append(evicted, k) })
+		p := a.(Pruner)
+		Assert(p.RemoveIf(func(k, v interface{}) bool { return true }) == 0, t)
+		for i := 0; i < 10; i++ {
+			a.Add(i, i*10)
+		}
+		a.Find(4)
+		n := p.RemoveIf(func(k, v interface{}) bool { return k.(int)%2 == 0 })
+		Assert(n == 5 && a.Size() == 5, t)
+		Assert(slices.Equal(evicted, []interface{}{0, 2, 6, 8, 4}), t)
+		Assert(slices.Equal(CollectKeys(a.(Ranger)), []interface{}{9, 7, 5, 3, 1}), t)
+
+		// freed nodes come back through the pool without harm
+		a.Add(20, 200)
+		Assert(a.Find(20) == 200 && a.Size() == 6, t)
+
+		evicted = nil
+		Assert(p.RemoveIf(func(k, v interface{}) bool { return true }) == 6, t)
+		Assert(a.Size() == 0 && len(evicted) == 6, t)
+		a.Add(1, 1)
+		Assert(a.Find(1) == 1, t)
+	}
+}
+
+func TestEvictWhile(t *testing.T) {
+	for _, a := range []LRUCache{NewLRUCache(10), NewThreadUnsafeLRUCache(10)} {
+		var evicted []interface{}
+		a.(Evictable).SetOnEvict(func(k, v interface{}) { evicted = append(evicted, k) })
+		p := a.(Pruner)
+		Assert(p.EvictWhile(func(k, v interface{}) bool { return true }) == 0, t)
+		// v is a version, drop everything older than 5
+		for i := 0; i < 10; i++ {
+			a.Add(i, i)
+		}
+		a.Find(2)
+		n := p.EvictWhile(func(k, v interface{}) bool { return v.(int) < 5 })
+		// stops at the first entry that is new enough, 2 was touched so it is behind 9 and stays
+		Assert(n == 4, t)
+		Assert(slices.Equal(evicted, []interface{}{0, 1, 3, 4}), t)
+		Assert(a.Size() == 6 && a.Find(2) == 2, t)
+
+		Assert(p.EvictWhile(func(k, v interface{}) bool { return true }) == 6, t)
+		Assert(a.Size() == 0, t)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	for _, a := range []LRUCache{NewLRUCache(10), NewThreadUnsafeLRUCache(10)} {
+		for i := 0; i < 10; i++ {
+			a.Add(i, i)
+		}
+		var keys []interface{}
+		for k := range a.(Ranger).Filter(func(k, v interface{}) bool { return v.(int) > 6 }) {
+			keys = append(keys, k)
+		}
+		Assert(slices.Equal(keys, []interface{}{9, 8, 7}), t)
+
+		// the matches were taken in one pass, changes in the loop do not affect them
+		keys = nil
+		for k := range a.(Ranger).Filter(func(k, v interface{}) bool { return v.(int)%2 == 0 }) {
+			a.Remove(k.(int) - 2)
+			a.Add(100+k.(int), 0)
+			keys = append(keys, k)
+		}
+		Assert(slices.Equal(keys, []interface{}{8, 6, 4, 2, 0}), t)
+	}
+}
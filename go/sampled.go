@@ -0,0 +1,278 @@
+package lru
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+const (
+	defaultSamples   = 5  // 默认每次淘汰采样的数量，和redis的maxmemory-samples一样
+	evictionPoolSize = 16 // 淘汰池的大小，和redis的EVPOOL_SIZE一样
+)
+
+// 淘汰池里的候选
+type sampledCandidate struct {
+	key    lruKey // 候选的key
+	access uint64 // 采样时的最后访问时间
+}
+
+/**
+近似LRU缓存 (类似redis allkeys-lru)
+每个entry只存一个最后访问时间，没有双向链表
+key、value、访问时间都放在平铺的slice里，删除时用最后一个填补空位
+满了之后随机采样N个entry，把最旧的放进淘汰池，从淘汰池里选出最旧的淘汰
+用准确性换内存
+*/
+type threadUnsafeSampledLRU struct {
+	dict    map[lruKey]int     // key -> 在slice中的位置
+	keys    []lruKey           // 所有的key
+	values  []lruValue         // 所有的value
+	access  []uint64           // 最后访问时间(逻辑时钟)
+	clock   uint64             // 逻辑时钟，每次访问+1
+	cap     int                // 总量
+	samples int                // 每次淘汰采样的数量
+	pool    []sampledCandidate // 淘汰池，按访问时间从旧到新排序
+	rand    *rand.Rand         // 采样用的随机数
+}
+
+func newThreadUnsafeSampledLRU(samples int) *threadUnsafeSampledLRU {
+	if samples <= 0 {
+		samples = defaultSamples
+	}
+	return &threadUnsafeSampledLRU{samples: samples}
+}
+
+/**
+创建缓存
+cap: 容量，缓存最多存多少数据
+*/
+func (cache *threadUnsafeSampledLRU) Create(cap int) {
+	cache.dict = make(map[lruKey]int)
+	cache.keys = make([]lruKey, 0, cap)
+	cache.values = make([]lruValue, 0, cap)
+	cache.access = make([]uint64, 0, cap)
+	cache.clock = 0
+	cache.cap = cap
+	cache.pool = make([]sampledCandidate, 0, evictionPoolSize)
+	cache.rand = rand.New(rand.NewSource(int64(cap)))
+}
+
+/**
+添加一个元素
+已经存在时更新value和访问时间
+
+cost: O(1) 满了之后加上一次O(samples)的采样
+*/
+func (cache *threadUnsafeSampledLRU) Add(k lruKey, v lruValue) {
+	if i, ok := cache.dict[k]; ok {
+		cache.values[i] = v
+		cache.touch(i)
+		return
+	}
+	if cache.cap <= 0 {
+		return
+	}
+	if len(cache.keys) >= cache.cap {
+		cache.evict()
+	}
+	cache.clock++
+	cache.dict[k] = len(cache.keys)
+	cache.keys = append(cache.keys, k)
+	cache.values = append(cache.values, v)
+	cache.access = append(cache.access, cache.clock)
+}
+
+/**
+查找一个元素
+命中时只更新访问时间
+
+cost: O(1)
+*/
+func (cache *threadUnsafeSampledLRU) Find(k lruKey) lruValue {
+	i, ok := cache.dict[k]
+	if !ok {
+		return nil
+	}
+	cache.touch(i)
+	return cache.values[i]
+}
+
+func (cache *threadUnsafeSampledLRU) Size() int {
+	return len(cache.keys)
+}
+
+/**
+删除一个元素
+k: key
+return: value or nil
+*/
+func (cache *threadUnsafeSampledLRU) Remove(k lruKey) lruValue {
+	i, ok := cache.dict[k]
+	if !ok {
+		return nil
+	}
+	return cache.removeAt(i)
+}
+
+/**
+遍历缓存中所有的数据的迭代器
+需要按访问时间排序，cost: O(n log n)
+reverse: true = 从最旧的开始 false = 从最新的开始
+*/
+func (cache *threadUnsafeSampledLRU) Iterator(reverse bool) *Iterator {
+	return newSliceIterator(cache.pairs(reverse))
+}
+
+func (cache *threadUnsafeSampledLRU) Iter(reverse bool) <-chan lruPair {
+	return newSliceIterator(cache.pairs(reverse)).C
+}
+
+func (cache *threadUnsafeSampledLRU) touch(i int) {
+	cache.clock++
+	cache.access[i] = cache.clock
+}
+
+/**
+删除位置i的entry，用最后一个entry填补
+*/
+func (cache *threadUnsafeSampledLRU) removeAt(i int) lruValue {
+	v := cache.values[i]
+	delete(cache.dict, cache.keys[i])
+
+	last := len(cache.keys) - 1
+	if i != last {
+		cache.keys[i] = cache.keys[last]
+		cache.values[i] = cache.values[last]
+		cache.access[i] = cache.access[last]
+		cache.dict[cache.keys[i]] = i
+	}
+	// 置空，让gc可以回收
+	cache.keys[last] = nil
+	cache.values[last] = nil
+	cache.keys = cache.keys[:last]
+	cache.values = cache.values[:last]
+	cache.access = cache.access[:last]
+	return v
+}
+
+/**
+淘汰一个entry
+1.随机采样samples个entry，比池子里最新的还旧的放进淘汰池
+2.从池子里最旧的开始，找到一个仍然有效(没被删除也没被访问过)的淘汰掉
+*/
+func (cache *threadUnsafeSampledLRU) evict() {
+	for len(cache.keys) > 0 {
+		cache.populate()
+		for len(cache.pool) > 0 {
+			c := cache.pool[0]
+			// 从池子头部拿出来，原地前移，不重新分配
+			copy(cache.pool, cache.pool[1:])
+			cache.pool[len(cache.pool)-1] = sampledCandidate{}
+			cache.pool = cache.pool[:len(cache.pool)-1]
+			i, ok := cache.dict[c.key]
+			if !ok || cache.access[i] != c.access {
+				continue // 过期的候选
+			}
+			cache.removeAt(i)
+			return
+		}
+	}
+}
+
+// 采样并填充淘汰池
+func (cache *threadUnsafeSampledLRU) populate() {
+	n := len(cache.keys)
+	for s := 0; s < cache.samples; s++ {
+		i := cache.rand.Intn(n)
+		c := sampledCandidate{cache.keys[i], cache.access[i]}
+		// 找到插入位置，池子按访问时间从旧到新
+		pos := sort.Search(len(cache.pool), func(j int) bool {
+			return cache.pool[j].access >= c.access
+		})
+		if pos < len(cache.pool) && cache.pool[pos].key == c.key {
+			continue // 已经在池子里了
+		}
+		if len(cache.pool) >= evictionPoolSize {
+			if pos == len(cache.pool) {
+				continue // 比池子里所有的都新
+			}
+			// 挤掉最新的那个
+			cache.pool = cache.pool[:len(cache.pool)-1]
+		}
+		cache.pool = append(cache.pool, sampledCandidate{})
+		copy(cache.pool[pos+1:], cache.pool[pos:])
+		cache.pool[pos] = c
+	}
+}
+
+// 按访问时间排序的所有entry
+func (cache *threadUnsafeSampledLRU) pairs(reverse bool) []lruPair {
+	index := make([]int, len(cache.keys))
+	for i := range index {
+		index[i] = i
+	}
+	sort.Slice(index, func(i, j int) bool {
+		if reverse {
+			return cache.access[index[i]] < cache.access[index[j]]
+		}
+		return cache.access[index[i]] > cache.access[index[j]]
+	})
+	pairs := make([]lruPair, len(index))
+	for i, j := range index {
+		pairs[i] = lruPair{cache.keys[j], cache.values[j]}
+	}
+	return pairs
+}
+
+/**
+线程安全的近似LRU缓存
+*/
+type threadSafeSampledLRU struct {
+	c          *threadUnsafeSampledLRU
+	sync.Mutex // 协程锁，Find也要更新访问时间
+}
+
+func newThreadSafeSampledLRU(samples int) *threadSafeSampledLRU {
+	return &threadSafeSampledLRU{c: newThreadUnsafeSampledLRU(samples)}
+}
+
+func (cache *threadSafeSampledLRU) Create(cap int) {
+	cache.c.Create(cap)
+}
+
+func (cache *threadSafeSampledLRU) Add(k lruKey, v lruValue) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.c.Add(k, v)
+}
+
+func (cache *threadSafeSampledLRU) Find(k lruKey) lruValue {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Find(k)
+}
+
+func (cache *threadSafeSampledLRU) Size() int {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Size()
+}
+
+func (cache *threadSafeSampledLRU) Remove(k lruKey) lruValue {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Remove(k)
+}
+
+func (cache *threadSafeSampledLRU) Iterator(reverse bool) *Iterator {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Iterator(reverse)
+}
+
+func (cache *threadSafeSampledLRU) Iter(reverse bool) <-chan lruPair {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.Iter(reverse)
+}
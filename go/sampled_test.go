@@ -0,0 +1,104 @@
+package lru
+
+import "testing"
+
+func TestSampledLRU_Add(t *testing.T) {
+	a := NewSampledLRUCache(10, 0)
+
+	v3 := &struct{}{}
+	a.Add(1, 1)
+	a.Add(2, "two")
+	a.Add(3, v3)
+	a.Add(2, "2")
+
+	Assert(a.Size() == 3, t)
+	Assert(a.Find(1) == 1, t)
+	Assert(a.Find(2) == "2", t)
+	Assert(a.Find(3) == v3, t)
+	Assert(a.Find(4) == nil, t)
+}
+
+func TestSampledLRU_Remove(t *testing.T) {
+	a := NewThreadUnsafeSampledLRUCache(10, 0)
+
+	a.Add(1, 1)
+	a.Add(2, "two")
+	a.Add(3, 3)
+
+	Assert(a.Remove(1) == 1, t)
+	Assert(a.Remove(1) == nil, t)
+	Assert(a.Size() == 2, t)
+	// the last entry moved into the hole
+	Assert(a.Find(3) == 3, t)
+	Assert(a.Find(2) == "two", t)
+}
+
+func TestSampledLRU_Create(t *testing.T) {
+	a := NewThreadUnsafeSampledLRUCache(100, 5)
+	for i := 0; i < 1000; i++ {
+		a.Add(i, i)
+	}
+	Assert(a.Size() == 100, t)
+}
+
+// with as many samples as entries the pool always sees the oldest one,
+// so the sampled mode is exact
+func TestSampledLRU_Exact(t *testing.T) {
+	a := NewThreadUnsafeSampledLRUCache(10, 1000)
+	for i := 0; i < 10; i++ {
+		a.Add(i, i)
+	}
+	a.Find(0)
+	a.Add(10, 10) // evicts 1
+
+	Assert(a.Find(1) == nil, t)
+	Assert(a.Find(0) == 0, t)
+	Assert(a.Find(10) == 10, t)
+}
+
+// hot keys survive a scan of cold keys
+func TestSampledLRU_Approximate(t *testing.T) {
+	a := NewThreadUnsafeSampledLRUCache(1000, 0)
+	for i := 0; i < 10000; i++ {
+		a.Add(i, i)
+		a.Find(-1 - i%100) // keep 100 hot keys fresh
+		if i < 100 {
+			a.Add(-1-i, i)
+		}
+	}
+	hits := 0
+	for i := 0; i < 100; i++ {
+		if a.Find(-1-i) != nil {
+			hits++
+		}
+	}
+	Assert(hits > 90, t)
+}
+
+func TestSampledLRU_Iter(t *testing.T) {
+	a := NewSampledLRUCache(10, 0)
+	exceptt := make([]lruPair, 10)
+	exceptf := make([]lruPair, 10)
+	for i := 0; i < 10; i++ {
+		a.Add(i, i)
+		exceptt[i] = lruPair{i, i}
+		exceptf[9-i] = lruPair{i, i}
+	}
+
+	resultt := make([]lruPair, 0, 10)
+	for p := range a.Iter(true) {
+		resultt = append(resultt, p)
+	}
+
+	iterator := a.Iterator(false)
+	resultf := make([]lruPair, 0, 10)
+	for p := range iterator.C {
+		resultf = append(resultf, p)
+		if p.k.(int) == 5 {
+			iterator.Stop()
+		}
+	}
+
+	AssertPairList(exceptt, resultt, t)
+	AssertPairList(exceptf[:5], resultf, t)
+}
@@ -0,0 +1,164 @@
+package lru
+
+import (
+	"iter"
+	"maps"
+	"slices"
+)
+
+// 把游标包装成range over func
+func cursorSeq2(c *Cursor) iter.Seq2[interface{}, interface{}] {
+	return func(yield func(k, v interface{}) bool) {
+		defer c.Close()
+		for c.Next() {
+			if !yield(c.Entry()) {
+				return
+			}
+		}
+	}
+}
+
+func keysOf(seq iter.Seq2[interface{}, interface{}]) iter.Seq[interface{}] {
+	return func(yield func(k interface{}) bool) {
+		for k := range seq {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+func valuesOf(seq iter.Seq2[interface{}, interface{}]) iter.Seq[interface{}] {
+	return func(yield func(v interface{}) bool) {
+		for _, v := range seq {
+			if !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+func pairsSeq2(pairs []lruPair) iter.Seq2[interface{}, interface{}] {
+	return func(yield func(k, v interface{}) bool) {
+		for _, p := range pairs {
+			if !yield(p.k, p.v) {
+				return
+			}
+		}
+	}
+}
+
+// 从新到旧走一遍链表，拷贝pred返回true的entry
+func (cache *threadUnsafeLRU) filter(pred func(k, v interface{}) bool) []lruPair {
+	var pairs []lruPair
+	cache.Range(false, func(k, v interface{}) bool {
+		if pred(k, v) {
+			pairs = append(pairs, lruPair{k, v})
+		}
+		return true
+	})
+	return pairs
+}
+
+/**
+从新到旧遍历(tail.prev -> head.next)
+每次range都新建一个游标，所以返回的seq可以多次使用
+循环体里可以修改缓存，新加或者被移动(Add、Find)的entry不会再遍历到，见Cursor
+for k, v := range cache.All() {}
+*/
+func (cache *threadUnsafeLRU) All() iter.Seq2[interface{}, interface{}] {
+	return func(yield func(k, v interface{}) bool) {
+		cursorSeq2(cache.Cursor(false))(yield)
+	}
+}
+
+// 从旧到新遍历(head.next -> tail.prev)
+func (cache *threadUnsafeLRU) Backward() iter.Seq2[interface{}, interface{}] {
+	return func(yield func(k, v interface{}) bool) {
+		cursorSeq2(cache.Cursor(true))(yield)
+	}
+}
+
+func (cache *threadUnsafeLRU) Keys() iter.Seq[interface{}] {
+	return keysOf(cache.All())
+}
+
+func (cache *threadUnsafeLRU) Values() iter.Seq[interface{}] {
+	return valuesOf(cache.All())
+}
+
+/**
+从新到旧遍历pred返回true的entry
+每次range先走一遍链表挑出来，再遍历拷贝，所以循环体里可以修改缓存
+pred里不能修改缓存
+*/
+func (cache *threadUnsafeLRU) Filter(pred func(k, v interface{}) bool) iter.Seq2[interface{}, interface{}] {
+	return func(yield func(k, v interface{}) bool) {
+		pairsSeq2(cache.filter(pred))(yield)
+	}
+}
+
+/**
+从新到旧遍历(tail.prev -> head.next)
+每一步只短暂持有读锁，循环体里可以调用这个cache
+和上面一样，循环体里新加或者被移动的entry不会再遍历到
+*/
+func (cache *threadSafeLRU) All() iter.Seq2[interface{}, interface{}] {
+	return func(yield func(k, v interface{}) bool) {
+		cursorSeq2(cache.Cursor(false))(yield)
+	}
+}
+
+// 从旧到新遍历(head.next -> tail.prev)
+func (cache *threadSafeLRU) Backward() iter.Seq2[interface{}, interface{}] {
+	return func(yield func(k, v interface{}) bool) {
+		cursorSeq2(cache.Cursor(true))(yield)
+	}
+}
+
+func (cache *threadSafeLRU) Keys() iter.Seq[interface{}] {
+	return keysOf(cache.All())
+}
+
+func (cache *threadSafeLRU) Values() iter.Seq[interface{}] {
+	return valuesOf(cache.All())
+}
+
+/**
+从新到旧遍历pred返回true的entry
+和RemoveIf一样在一次读锁里走一遍链表，pred调用时持有读锁，不能调用这个cache
+循环体里不持有锁，可以调用这个cache
+*/
+func (cache *threadSafeLRU) Filter(pred func(k, v interface{}) bool) iter.Seq2[interface{}, interface{}] {
+	return func(yield func(k, v interface{}) bool) {
+		cache.RLock()
+		pairs := cache.c.filter(pred)
+		cache.RUnlock()
+		pairsSeq2(pairs)(yield)
+	}
+}
+
+// 拷贝成map，可以直接用maps包的函数
+func Collect(r Ranger) map[interface{}]interface{} {
+	return maps.Collect(r.All())
+}
+
+// 从新到旧的所有key
+func CollectKeys(r Ranger) []interface{} {
+	return slices.Collect(r.Keys())
+}
+
+// 从新到旧的所有value
+func CollectValues(r Ranger) []interface{} {
+	return slices.Collect(r.Values())
+}
+
+/**
+按seq的顺序添加，最后一个是最新的
+lru.Insert(cache, maps.All(m)) 或者 lru.Insert(b, a.Backward()) 按原来的顺序拷贝一个缓存
+*/
+func Insert(cache LRUCache, seq iter.Seq2[interface{}, interface{}]) {
+	for k, v := range seq {
+		cache.Add(k, v)
+	}
+}
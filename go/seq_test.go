@@ -0,0 +1,84 @@
+package lru
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestSeq(t *testing.T) {
+	for _, a := range []LRUCache{NewLRUCache(4), NewThreadUnsafeLRUCache(4)} {
+		r := a.(Ranger)
+		for range r.All() {
+			t.Fatal("empty cache")
+		}
+		for i := 1; i <= 5; i++ {
+			a.Add(i, i*10)
+		}
+		a.Find(3)
+
+		var got []lruPair
+		for k, v := range r.All() {
+			got = append(got, lruPair{k, v})
+		}
+		AssertPairList([]lruPair{{3, 30}, {5, 50}, {4, 40}, {2, 20}}, got, t)
+
+		got = got[:0]
+		for k, v := range r.Backward() {
+			got = append(got, lruPair{k, v})
+		}
+		AssertPairList([]lruPair{{2, 20}, {4, 40}, {5, 50}, {3, 30}}, got, t)
+
+		Assert(slices.Equal(CollectKeys(r), []interface{}{3, 5, 4, 2}), t)
+		Assert(slices.Equal(CollectValues(r), []interface{}{30, 50, 40, 20}), t)
+		Assert(maps.Equal(Collect(r), map[interface{}]interface{}{2: 20, 3: 30, 4: 40, 5: 50}), t)
+		Assert(slices.Equal(slices.Collect(r.Keys()), CollectKeys(r)), t)
+
+		// break stops early
+		n := 0
+		for range r.Keys() {
+			n++
+			break
+		}
+		Assert(n == 1, t)
+
+		// the body may change the cache, even the thread safe one
+		for k := range r.Backward() {
+			if k.(int)%2 == 0 {
+				a.Remove(k)
+			}
+		}
+		Assert(slices.Equal(CollectKeys(r), []interface{}{3, 5}), t)
+
+		// Find moves each key to the tail, ahead of Backward
+		n = 0
+		for k := range r.Backward() {
+			a.Find(k)
+			if n++; n > 10 {
+				t.Fatal("Backward did not end")
+			}
+		}
+		Assert(n == 2, t)
+		Assert(slices.Equal(CollectKeys(r), []interface{}{3, 5}), t)
+
+		// copying a cache into itself ends too
+		Insert(a, r.Backward())
+		Assert(slices.Equal(CollectKeys(r), []interface{}{3, 5}), t)
+	}
+}
+
+func TestSeq_Insert(t *testing.T) {
+	a := NewThreadUnsafeLRUCache(3)
+	for i := 0; i < 3; i++ {
+		a.Add(i, i)
+	}
+	// copy keeps the order when fed oldest first
+	b := NewLRUCache(3)
+	Insert(b, a.(Ranger).Backward())
+	Assert(slices.Equal(CollectKeys(b.(Ranger)), CollectKeys(a.(Ranger))), t)
+
+	m := map[interface{}]interface{}{"x": 1, "y": 2}
+	c := NewLRUCache(10)
+	Insert(c, maps.All(m))
+	Assert(maps.Equal(Collect(c.(Ranger)), m), t)
+}
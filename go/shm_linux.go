@@ -0,0 +1,406 @@
+//go:build linux
+
+package lru
+
+import (
+	"encoding/binary"
+	"errors"
+	"os"
+	"sync"
+	"syscall"
+)
+
+var (
+	ErrSharedTooLarge = errors.New("lru: key and value do not fit in a slot")
+	ErrSharedGeometry = errors.New("lru: shared cache file has a different layout")
+	ErrSharedClosed   = errors.New("lru: shared cache is closed")
+)
+
+/**
+文件布局(小端)
+header:
+	0  magic "LRUM"
+	4  version
+	8  slots      slot个数
+	16 slotSize   一个slot能放的key+value字节数
+	24 buckets    哈希桶个数
+	32 len        已用的slot个数
+	40 head       最旧的slot
+	48 tail       最新的slot
+	56 free       空闲链表
+buckets: buckets个uint64，每个桶是一条哈希链
+slots: 每个slot是slotHeader + slotSize字节的数据
+	0  prev, 8 next  lru链表(空闲时next串成空闲链表)
+	16 hnext         哈希链
+	24 hash
+	32 keyLen, 36 valLen
+	40 key, value
+所有的"指针"都是slot在文件里的偏移量，0表示空(偏移0是header，不会有slot)
+*/
+const (
+	shmMagic   = "LRUM"
+	shmVersion = 1
+
+	shmSlots      = 8
+	shmSlotSize   = 16
+	shmBuckets    = 24
+	shmLen        = 32
+	shmHead       = 40
+	shmTail       = 48
+	shmFree       = 56
+	shmHeaderSize = 64
+
+	slotPrev       = 0
+	slotNext       = 8
+	slotHNext      = 16
+	slotHash       = 24
+	slotKeyLen     = 32
+	slotValLen     = 36
+	slotHeaderSize = 40
+)
+
+/**
+多个进程共享的lru缓存
+数据放在mmap的文件里，用offset代替指针，所以每个进程映射到哪个地址都可以
+跨进程用flock加锁，进程内再加一个mutex(同一个fd上的flock不互斥)
+Find也会移动lru链表，所以所有操作都是独占锁
+持锁的进程在修改中途崩溃会留下不一致的文件，需要删掉重建
+*/
+type SharedCache struct {
+	f        *os.File
+	data     []byte
+	slots    uint64
+	slotSize uint64
+	buckets  uint64
+	mu       sync.Mutex
+}
+
+/**
+打开或者创建共享缓存
+path: 文件路径，不存在时创建
+slots: 最多存多少个key
+slotSize: key+value的最大字节数
+已经存在的文件必须是同样的slots和slotSize
+*/
+func OpenSharedCache(path string, slots, slotSize int) (*SharedCache, error) {
+	if slots <= 0 || slotSize <= 0 {
+		return nil, ErrSharedGeometry
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	c := &SharedCache{
+		f:        f,
+		slots:    uint64(slots),
+		slotSize: uint64(slotSize),
+		buckets:  uint64(slots),
+	}
+	if err := c.attach(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *SharedCache) fileSize() int64 {
+	return int64(shmHeaderSize + c.buckets*8 + c.slots*(slotHeaderSize+c.slotSize))
+}
+
+// 映射文件，新文件在文件锁里初始化，防止两个进程同时初始化
+func (c *SharedCache) attach() error {
+	if err := syscall.Flock(int(c.f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(c.f.Fd()), syscall.LOCK_UN)
+
+	fi, err := c.f.Stat()
+	if err != nil {
+		return err
+	}
+	fresh := fi.Size() == 0
+	if fresh {
+		if err := c.f.Truncate(c.fileSize()); err != nil {
+			return err
+		}
+	} else if fi.Size() != c.fileSize() {
+		return ErrSharedGeometry
+	}
+	c.data, err = syscall.Mmap(int(c.f.Fd()), 0, int(c.fileSize()), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	if fresh {
+		c.init()
+		return nil
+	}
+	if string(c.data[:4]) != shmMagic ||
+		binary.LittleEndian.Uint32(c.data[4:]) != shmVersion ||
+		c.u64(shmSlots) != c.slots || c.u64(shmSlotSize) != c.slotSize || c.u64(shmBuckets) != c.buckets {
+		syscall.Munmap(c.data)
+		c.data = nil
+		return ErrSharedGeometry
+	}
+	return nil
+}
+
+// 写header，清空桶，所有slot串成空闲链表
+func (c *SharedCache) init() {
+	copy(c.data, shmMagic)
+	binary.LittleEndian.PutUint32(c.data[4:], shmVersion)
+	c.put64(shmSlots, c.slots)
+	c.put64(shmSlotSize, c.slotSize)
+	c.put64(shmBuckets, c.buckets)
+	c.put64(shmLen, 0)
+	c.put64(shmHead, 0)
+	c.put64(shmTail, 0)
+	for i := uint64(0); i < c.buckets; i++ {
+		c.put64(shmHeaderSize+i*8, 0)
+	}
+	var next uint64
+	for i := c.slots; i > 0; i-- {
+		off := c.slotOffset(i - 1)
+		c.put64(off+slotNext, next)
+		next = off
+	}
+	c.put64(shmFree, next)
+}
+
+func (c *SharedCache) lock() error {
+	c.mu.Lock()
+	if c.data == nil {
+		c.mu.Unlock()
+		return ErrSharedClosed
+	}
+	if err := syscall.Flock(int(c.f.Fd()), syscall.LOCK_EX); err != nil {
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (c *SharedCache) unlock() {
+	syscall.Flock(int(c.f.Fd()), syscall.LOCK_UN)
+	c.mu.Unlock()
+}
+
+/**
+添加一个元素，满了淘汰最旧的
+k和v一起不能超过slotSize
+*/
+func (c *SharedCache) Add(k string, v []byte) error {
+	if uint64(len(k)+len(v)) > c.slotSize {
+		return ErrSharedTooLarge
+	}
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+
+	h := fnvString(k)
+	off := c.find(k, h)
+	if off == 0 {
+		off = c.alloc()
+		bucket := c.bucketOffset(h)
+		c.put64(off+slotHNext, c.u64(bucket))
+		c.put64(bucket, off)
+		c.put64(off+slotHash, h)
+		c.put64(shmLen, c.u64(shmLen)+1)
+	} else {
+		c.unlinkList(off)
+	}
+	binary.LittleEndian.PutUint32(c.data[off+slotKeyLen:], uint32(len(k)))
+	binary.LittleEndian.PutUint32(c.data[off+slotValLen:], uint32(len(v)))
+	copy(c.data[off+slotHeaderSize:], k)
+	copy(c.data[off+slotHeaderSize+uint64(len(k)):], v)
+	c.appendTail(off)
+	return nil
+}
+
+/**
+查找一个元素，找到了移到链表尾部
+return: value的拷贝，没找到是nil
+*/
+func (c *SharedCache) Find(k string) []byte {
+	if c.lock() != nil {
+		return nil
+	}
+	defer c.unlock()
+	off := c.find(k, fnvString(k))
+	if off == 0 {
+		return nil
+	}
+	c.unlinkList(off)
+	c.appendTail(off)
+	return append([]byte{}, c.value(off)...)
+}
+
+/**
+删除一个元素
+return: 被删除的value，没找到是nil
+*/
+func (c *SharedCache) Remove(k string) []byte {
+	if c.lock() != nil {
+		return nil
+	}
+	defer c.unlock()
+	off := c.find(k, fnvString(k))
+	if off == 0 {
+		return nil
+	}
+	v := append([]byte{}, c.value(off)...)
+	c.unlinkList(off)
+	c.unlinkHash(off)
+	c.put64(off+slotNext, c.u64(shmFree))
+	c.put64(shmFree, off)
+	c.put64(shmLen, c.u64(shmLen)-1)
+	return v
+}
+
+func (c *SharedCache) Size() int {
+	if c.lock() != nil {
+		return 0
+	}
+	defer c.unlock()
+	return int(c.u64(shmLen))
+}
+
+// drop every key for every process
+func (c *SharedCache) Clear() error {
+	if err := c.lock(); err != nil {
+		return err
+	}
+	defer c.unlock()
+	c.init()
+	return nil
+}
+
+/**
+遍历所有key
+reverse: 和Iterator一样，true从最旧的开始，false从最新的开始
+遍历期间持有锁，fn里不能再调用这个缓存
+*/
+func (c *SharedCache) Range(reverse bool, fn func(k string, v []byte) bool) {
+	if c.lock() != nil {
+		return
+	}
+	defer c.unlock()
+	off, link := c.u64(shmTail), uint64(slotPrev)
+	if reverse {
+		off, link = c.u64(shmHead), slotNext
+	}
+	for off != 0 {
+		if !fn(c.key(off), c.value(off)) {
+			return
+		}
+		off = c.u64(off + link)
+	}
+}
+
+// unmap and close the file, the file and its contents are kept
+func (c *SharedCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.data == nil {
+		return nil
+	}
+	err := syscall.Munmap(c.data)
+	c.data = nil
+	if cerr := c.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (c *SharedCache) find(k string, h uint64) uint64 {
+	for off := c.u64(c.bucketOffset(h)); off != 0; off = c.u64(off + slotHNext) {
+		if c.u64(off+slotHash) == h && c.keyEquals(off, k) {
+			return off
+		}
+	}
+	return 0
+}
+
+// 取一个空闲的slot，没有就淘汰最旧的
+func (c *SharedCache) alloc() uint64 {
+	if off := c.u64(shmFree); off != 0 {
+		c.put64(shmFree, c.u64(off+slotNext))
+		return off
+	}
+	off := c.u64(shmHead)
+	c.unlinkList(off)
+	c.unlinkHash(off)
+	c.put64(shmLen, c.u64(shmLen)-1)
+	return off
+}
+
+func (c *SharedCache) appendTail(off uint64) {
+	tail := c.u64(shmTail)
+	c.put64(off+slotPrev, tail)
+	c.put64(off+slotNext, 0)
+	if tail == 0 {
+		c.put64(shmHead, off)
+	} else {
+		c.put64(tail+slotNext, off)
+	}
+	c.put64(shmTail, off)
+}
+
+func (c *SharedCache) unlinkList(off uint64) {
+	prev, next := c.u64(off+slotPrev), c.u64(off+slotNext)
+	if prev == 0 {
+		c.put64(shmHead, next)
+	} else {
+		c.put64(prev+slotNext, next)
+	}
+	if next == 0 {
+		c.put64(shmTail, prev)
+	} else {
+		c.put64(next+slotPrev, prev)
+	}
+}
+
+func (c *SharedCache) unlinkHash(off uint64) {
+	link := c.bucketOffset(c.u64(off + slotHash))
+	for p := c.u64(link); p != 0; p = c.u64(link) {
+		if p == off {
+			c.put64(link, c.u64(off+slotHNext))
+			return
+		}
+		link = p + slotHNext
+	}
+}
+
+func (c *SharedCache) key(off uint64) string {
+	n := uint64(binary.LittleEndian.Uint32(c.data[off+slotKeyLen:]))
+	return string(c.data[off+slotHeaderSize : off+slotHeaderSize+n])
+}
+
+// 比较时不分配内存
+func (c *SharedCache) keyEquals(off uint64, k string) bool {
+	n := uint64(binary.LittleEndian.Uint32(c.data[off+slotKeyLen:]))
+	return string(c.data[off+slotHeaderSize:off+slotHeaderSize+n]) == k
+}
+
+func (c *SharedCache) value(off uint64) []byte {
+	kn := uint64(binary.LittleEndian.Uint32(c.data[off+slotKeyLen:]))
+	vn := uint64(binary.LittleEndian.Uint32(c.data[off+slotValLen:]))
+	start := off + slotHeaderSize + kn
+	return c.data[start : start+vn]
+}
+
+func (c *SharedCache) bucketOffset(h uint64) uint64 {
+	return shmHeaderSize + (h%c.buckets)*8
+}
+
+func (c *SharedCache) slotOffset(i uint64) uint64 {
+	return shmHeaderSize + c.buckets*8 + i*(slotHeaderSize+c.slotSize)
+}
+
+func (c *SharedCache) u64(off uint64) uint64 {
+	return binary.LittleEndian.Uint64(c.data[off:])
+}
+
+func (c *SharedCache) put64(off, v uint64) {
+	binary.LittleEndian.PutUint64(c.data[off:], v)
+}
@@ -0,0 +1,141 @@
+//go:build linux
+
+package lru
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func openShared(t *testing.T, path string, slots, slotSize int) *SharedCache {
+	t.Helper()
+	c, err := OpenSharedCache(path, slots, slotSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func sharedKeys(c *SharedCache, reverse bool) []string {
+	var keys []string
+	c.Range(reverse, func(k string, v []byte) bool {
+		keys = append(keys, k)
+		return true
+	})
+	return keys
+}
+
+func TestSharedCache(t *testing.T) {
+	c := openShared(t, filepath.Join(t.TempDir(), "cache"), 3, 32)
+
+	Assert(c.Find("a") == nil, t)
+	Assert(c.Add("a", []byte("1")) == nil, t)
+	Assert(c.Add("b", []byte("2")) == nil, t)
+	Assert(c.Add("c", []byte("3")) == nil, t)
+	Assert(string(c.Find("a")) == "1", t)
+	Assert(c.Add("d", []byte("4")) == nil, t) // evicts b
+	Assert(c.Find("b") == nil, t)
+	Assert(c.Size() == 3, t)
+	Assert(fmt.Sprint(sharedKeys(c, true)) == "[c a d]", t)
+	Assert(fmt.Sprint(sharedKeys(c, false)) == "[d a c]", t)
+
+	// update in place
+	Assert(c.Add("c", []byte("33")) == nil, t)
+	Assert(string(c.Find("c")) == "33", t)
+	Assert(c.Size() == 3, t)
+
+	Assert(string(c.Remove("a")) == "1", t)
+	Assert(c.Remove("a") == nil, t)
+	Assert(c.Size() == 2, t)
+	Assert(c.Add("e", []byte("5")) == nil, t)
+	Assert(c.Add("f", []byte("6")) == nil, t)
+	Assert(fmt.Sprint(sharedKeys(c, true)) == "[c e f]", t)
+
+	Assert(c.Add("big", make([]byte, 30)) == ErrSharedTooLarge, t)
+	Assert(c.Clear() == nil, t)
+	Assert(c.Size() == 0, t)
+	Assert(c.Find("c") == nil, t)
+}
+
+func TestSharedCache_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	c, err := OpenSharedCache(path, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Add("k", []byte("v"))
+	c.Close()
+	Assert(c.Find("k") == nil, t)
+	Assert(c.Add("k", nil) == ErrSharedClosed, t)
+
+	c = openShared(t, path, 10, 64)
+	Assert(string(c.Find("k")) == "v", t)
+
+	_, err = OpenSharedCache(path, 20, 64)
+	Assert(err == ErrSharedGeometry, t)
+}
+
+// two handles on one file behave like two processes
+func TestSharedCache_Handles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	a := openShared(t, path, 100, 64)
+	b := openShared(t, path, 100, 64)
+
+	a.Add("k", []byte("from a"))
+	Assert(string(b.Find("k")) == "from a", t)
+	b.Remove("k")
+	Assert(a.Find("k") == nil, t)
+
+	var wg sync.WaitGroup
+	for i, c := range []*SharedCache{a, b, a, b} {
+		wg.Add(1)
+		go func(i int, c *SharedCache) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				k := strconv.Itoa(i*1000 + j%150)
+				c.Add(k, []byte(k))
+				if v := c.Find(k); v != nil && string(v) != k {
+					t.Errorf("got %q for %q", v, k)
+				}
+				if j%7 == 0 {
+					c.Remove(k)
+				}
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	Assert(a.Size() <= 100 && a.Size() == len(sharedKeys(b, true)), t)
+}
+
+// the helper process writes keys into the file named by LRU_SHM_HELPER
+func TestSharedCache_HelperProcess(t *testing.T) {
+	path := os.Getenv("LRU_SHM_HELPER")
+	if path == "" {
+		t.Skip("helper process only")
+	}
+	c := openShared(t, path, 100, 64)
+	for i := 0; i < 10; i++ {
+		c.Add("child"+strconv.Itoa(i), []byte(strconv.Itoa(os.Getpid())))
+	}
+}
+
+func TestSharedCache_Processes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache")
+	c := openShared(t, path, 100, 64)
+	c.Add("parent", []byte("1"))
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSharedCache_HelperProcess$")
+	cmd.Env = append(os.Environ(), "LRU_SHM_HELPER="+path)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("helper failed: %v\n%s", err, out)
+	}
+	Assert(c.Size() == 11, t)
+	Assert(string(c.Find("child9")) == strconv.Itoa(cmd.Process.Pid), t)
+	Assert(string(c.Find("parent")) == "1", t)
+}
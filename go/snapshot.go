@@ -0,0 +1,324 @@
+package lru
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+/**
+快照文件格式 (整数都是大端)
+
+	magic    [4]byte "LRUS"
+	version  uint16
+	count    uint64  entry的数量
+	entries  count * (keylen uvarint, key, valuelen uvarint, value, ttl uvarint)  从head.next到tail.prev
+	checksum uint32  前面所有字节的crc32(IEEE)，后面不能再有数据
+
+ttl是保存时剩下的纳秒数，0表示不过期，只有实现了Expiring的value才有
+恢复时从当前时间重新算过期时间，所以停机的时间不算在内
+版本1没有ttl，仍然可以读
+*/
+const (
+	snapshotVersion   = 2
+	snapshotVersionV1 = 1 // 没有ttl的旧格式
+	snapshotMagic     = "LRUS"
+	maxSnapshotItem   = 1 << 30 // 单个key或value的最大长度，防止损坏的文件导致分配过多内存
+)
+
+var (
+	ErrBadSnapshot      = errors.New("lru: corrupt snapshot")
+	ErrSnapshotVersion  = errors.New("lru: unsupported snapshot version")
+	ErrSnapshotChecksum = errors.New("lru: snapshot checksum mismatch")
+)
+
+/**
+带过期时间的value
+缓存本身不管过期，快照会保存剩下的时间，恢复时用WithExpiry重新设置
+保存时已经过期的entry不会写进快照
+*/
+type Expiring interface {
+	// the deadline, the zero time means never
+	ExpiresAt() time.Time
+
+	// the same value with a new deadline
+	WithExpiry(t time.Time) interface{}
+}
+
+// 可以保存到磁盘并恢复的缓存
+// NewLRUCache 和 NewThreadUnsafeLRUCache 返回的缓存都实现了这个接口
+type Snapshotter interface {
+	// set the codec for keys and values, default is GobCodec
+	SetCodec(codec Codec)
+
+	// write every entry from the least to the most recently used
+	SaveTo(w io.Writer) error
+
+	// replace the content of the cache with a snapshot, keeping the recency order
+	// and the remaining time of Expiring values
+	LoadFrom(r io.Reader) error
+}
+
+func (cache *threadUnsafeLRU) SetCodec(codec Codec) {
+	cache.codec = codec
+}
+
+/**
+保存快照
+从head.next到tail.prev，也就是从最旧到最新
+*/
+func (cache *threadUnsafeLRU) SaveTo(w io.Writer) error {
+	return writeSnapshot(w, cache.pairs(), cache.getCodec())
+}
+
+/**
+恢复快照
+先读完整个文件并校验，校验通过后才会替换缓存的内容
+快照里的entry比容量多时，最旧的会被淘汰
+*/
+func (cache *threadUnsafeLRU) LoadFrom(r io.Reader) error {
+	pairs, err := readSnapshot(r, cache.getCodec())
+	if err != nil {
+		return err
+	}
+	cache.restore(pairs)
+	return nil
+}
+
+func (cache *threadUnsafeLRU) getCodec() Codec {
+	if cache.codec == nil {
+		return GobCodec
+	}
+	return cache.codec
+}
+
+// 从head.next到tail.prev的所有entry
+func (cache *threadUnsafeLRU) pairs() []lruPair {
+	pairs := make([]lruPair, 0, cache.len)
+	if cache.len == 0 {
+		return pairs
+	}
+	for p := cache.head.next; p != cache.tail; p = p.next {
+		pairs = append(pairs, lruPair{p.key, p.value})
+	}
+	return pairs
+}
+
+// 按Iterator(reverse)的顺序拷贝所有entry
+func (cache *threadUnsafeLRU) sortedPairs(reverse bool) []lruPair {
+	pairs := make([]lruPair, 0, cache.len)
+	cache.Range(reverse, func(k, v interface{}) bool {
+		pairs = append(pairs, lruPair{k, v})
+		return true
+	})
+	return pairs
+}
+
+// 清空缓存，按顺序添加，最后添加的在尾部(最新)
+func (cache *threadUnsafeLRU) restore(pairs []lruPair) {
+	cache.Create(cache.cap)
+	for _, p := range pairs {
+		cache.Add(p.k, p.v)
+	}
+}
+
+func (cache *threadSafeLRU) SetCodec(codec Codec) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.c.SetCodec(codec)
+}
+
+/**
+保存快照
+只在复制entry的时候加读锁，编码和写入不持有锁
+*/
+func (cache *threadSafeLRU) SaveTo(w io.Writer) error {
+	cache.RLock()
+	pairs := cache.c.pairs()
+	codec := cache.c.getCodec()
+	cache.RUnlock()
+	return writeSnapshot(w, pairs, codec)
+}
+
+/**
+恢复快照
+读取和解码不持有锁，替换内容时加写锁
+*/
+func (cache *threadSafeLRU) LoadFrom(r io.Reader) error {
+	cache.RLock()
+	codec := cache.c.getCodec()
+	cache.RUnlock()
+	pairs, err := readSnapshot(r, codec)
+	if err != nil {
+		return err
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	cache.c.restore(pairs)
+	return nil
+}
+
+func writeSnapshot(w io.Writer, pairs []lruPair, codec Codec) error {
+	// 过期的不写，剩下的记下还有多久
+	now := time.Now()
+	ttls := make([]time.Duration, 0, len(pairs))
+	live := pairs[:0:0]
+	for _, p := range pairs {
+		var ttl time.Duration
+		if e, ok := p.v.(Expiring); ok && !e.ExpiresAt().IsZero() {
+			if ttl = e.ExpiresAt().Sub(now); ttl <= 0 {
+				continue
+			}
+		}
+		live = append(live, p)
+		ttls = append(ttls, ttl)
+	}
+	pairs = live
+
+	bw := bufio.NewWriter(w)
+	crc := crc32.NewIEEE()
+	out := io.MultiWriter(bw, crc)
+
+	header := make([]byte, 0, 14)
+	header = append(header, snapshotMagic...)
+	header = binary.BigEndian.AppendUint16(header, snapshotVersion)
+	header = binary.BigEndian.AppendUint64(header, uint64(len(pairs)))
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	lenbuf := make([]byte, binary.MaxVarintLen64)
+	writeItem := func(v interface{}) error {
+		data, err := codec.Marshal(v)
+		if err != nil {
+			return err
+		}
+		n := binary.PutUvarint(lenbuf, uint64(len(data)))
+		if _, err := out.Write(lenbuf[:n]); err != nil {
+			return err
+		}
+		_, err = out.Write(data)
+		return err
+	}
+	for i, p := range pairs {
+		if err := writeItem(p.k); err != nil {
+			return err
+		}
+		if err := writeItem(p.v); err != nil {
+			return err
+		}
+		n := binary.PutUvarint(lenbuf, uint64(ttls[i]))
+		if _, err := out.Write(lenbuf[:n]); err != nil {
+			return err
+		}
+	}
+
+	if err := binary.Write(bw, binary.BigEndian, crc.Sum32()); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+func readSnapshot(r io.Reader, codec Codec) ([]lruPair, error) {
+	crc := crc32.NewIEEE()
+	in := &checksumReader{bufio.NewReader(r), crc}
+
+	header := make([]byte, 14)
+	if _, err := io.ReadFull(in, header); err != nil {
+		return nil, ErrBadSnapshot
+	}
+	if string(header[:4]) != snapshotMagic {
+		return nil, ErrBadSnapshot
+	}
+	version := binary.BigEndian.Uint16(header[4:6])
+	if version != snapshotVersion && version != snapshotVersionV1 {
+		return nil, ErrSnapshotVersion
+	}
+	count := binary.BigEndian.Uint64(header[6:])
+
+	// 先读出原始的字节并校验checksum，校验通过后再解码
+	readItem := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(in)
+		if err != nil || n > maxSnapshotItem {
+			return nil, ErrBadSnapshot
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(in, data); err != nil {
+			return nil, ErrBadSnapshot
+		}
+		return data, nil
+	}
+	items := make([][]byte, 0)
+	ttls := make([]time.Duration, 0)
+	for i := uint64(0); i < count; i++ {
+		for j := 0; j < 2; j++ {
+			data, err := readItem()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, data)
+		}
+		var ttl uint64
+		if version != snapshotVersionV1 {
+			var err error
+			if ttl, err = binary.ReadUvarint(in); err != nil {
+				return nil, ErrBadSnapshot
+			}
+		}
+		ttls = append(ttls, time.Duration(ttl))
+	}
+
+	sum := crc.Sum32()
+	var want uint32
+	if err := binary.Read(in.r, binary.BigEndian, &want); err != nil {
+		return nil, ErrBadSnapshot
+	}
+	if sum != want {
+		return nil, ErrSnapshotChecksum
+	}
+	if _, err := in.r.ReadByte(); err != io.EOF {
+		return nil, ErrBadSnapshot // checksum后面还有数据
+	}
+
+	now := time.Now()
+	pairs := make([]lruPair, 0, len(items)/2)
+	for i := 0; i < len(items); i += 2 {
+		k, err := codec.Unmarshal(items[i])
+		if err != nil {
+			return nil, err
+		}
+		v, err := codec.Unmarshal(items[i+1])
+		if err != nil {
+			return nil, err
+		}
+		if e, ok := v.(Expiring); ok && ttls[i/2] > 0 {
+			v = e.WithExpiry(now.Add(ttls[i/2]))
+		}
+		pairs = append(pairs, lruPair{k, v})
+	}
+	return pairs, nil
+}
+
+// 边读边算checksum
+type checksumReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (cr *checksumReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.crc.Write(p[:n])
+	return n, err
+}
+
+func (cr *checksumReader) ReadByte() (byte, error) {
+	b, err := cr.r.ReadByte()
+	if err == nil {
+		cr.crc.Write([]byte{b})
+	}
+	return b, err
+}
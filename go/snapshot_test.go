@@ -0,0 +1,168 @@
+package lru
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+	"time"
+)
+
+func iterPairs(a LRUCache) []lruPair {
+	result := make([]lruPair, 0, a.Size())
+	for p := range a.Iter(true) {
+		result = append(result, p)
+	}
+	return result
+}
+
+func testSnapshotRoundTrip(t *testing.T, a, b LRUCache) {
+	a.Add(1, 1)
+	a.Add("two", "two")
+	a.Add(3, []byte("three"))
+	a.Find(1) // 1 becomes the most recent
+
+	var buf bytes.Buffer
+	if err := a.(Snapshotter).SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Add("stale", "stale")
+	if err := b.(Snapshotter).LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	Assert(b.Size() == 3, t)
+	Assert(b.Find("stale") == nil, t)
+	result := iterPairs(b)
+	Assert(len(result) == 3, t)
+	Assert(result[0] == lruPair{"two", "two"}, t)
+	Assert(result[2] == lruPair{1, 1}, t)
+	Assert(bytes.Equal(result[1].v.([]byte), []byte("three")), t)
+}
+
+func TestThreadSafeLRU_Snapshot(t *testing.T) {
+	testSnapshotRoundTrip(t, NewLRUCache(10), NewLRUCache(10))
+}
+
+func TestThreadUnsafeLRU_Snapshot(t *testing.T) {
+	testSnapshotRoundTrip(t, NewThreadUnsafeLRUCache(10), NewThreadUnsafeLRUCache(10))
+}
+
+// a cache nothing was ever added to
+func TestSnapshot_Empty(t *testing.T) {
+	var buf bytes.Buffer
+	Assert(NewLRUCache(10).(Snapshotter).SaveTo(&buf) == nil, t)
+	b := NewLRUCache(10)
+	b.Add(1, 1)
+	Assert(b.(Snapshotter).LoadFrom(&buf) == nil, t)
+	Assert(b.Size() == 0, t)
+}
+
+func TestSnapshot_SmallerCap(t *testing.T) {
+	a := NewThreadUnsafeLRUCache(10)
+	for i := 0; i < 10; i++ {
+		a.Add(i, i)
+	}
+	var buf bytes.Buffer
+	if err := a.(Snapshotter).SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// the oldest entries are evicted
+	b := NewThreadUnsafeLRUCache(3)
+	if err := b.(Snapshotter).LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	AssertPairList([]lruPair{{7, 7}, {8, 8}, {9, 9}}, iterPairs(b), t)
+}
+
+func TestSnapshot_Corrupt(t *testing.T) {
+	a := NewLRUCache(10)
+	a.Add(1, "one")
+	a.Add(2, "two")
+	var buf bytes.Buffer
+	if err := a.(Snapshotter).SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	b := NewLRUCache(10)
+	b.Add("keep", "keep")
+	s := b.(Snapshotter)
+
+	flipped := append([]byte{}, data...)
+	flipped[len(flipped)-6] ^= 0xff
+	Assert(s.LoadFrom(bytes.NewReader(flipped)) == ErrSnapshotChecksum, t)
+
+	Assert(s.LoadFrom(bytes.NewReader(data[:len(data)-2])) == ErrBadSnapshot, t)
+	Assert(s.LoadFrom(bytes.NewReader([]byte("nope"))) == ErrBadSnapshot, t)
+
+	version := append([]byte{}, data...)
+	version[5] = 9
+	Assert(s.LoadFrom(bytes.NewReader(version)) == ErrSnapshotVersion, t)
+
+	Assert(s.LoadFrom(bytes.NewReader(append(data, 0))) == ErrBadSnapshot, t)
+
+	// a rejected snapshot leaves the cache untouched
+	Assert(b.Size() == 1, t)
+	Assert(b.Find("keep") == "keep", t)
+}
+
+type ttlValue struct {
+	V       int
+	Expires time.Time
+}
+
+func (v ttlValue) ExpiresAt() time.Time { return v.Expires }
+
+func (v ttlValue) WithExpiry(t time.Time) interface{} {
+	v.Expires = t
+	return v
+}
+
+func init() {
+	RegisterType("lru.ttlValue", ttlValue{})
+}
+
+// the remaining time is kept, the time spent on disk does not count
+func TestSnapshot_TTL(t *testing.T) {
+	a := NewLRUCache(10)
+	now := time.Now()
+	a.Add(1, ttlValue{1, now.Add(time.Hour)})
+	a.Add(2, ttlValue{2, now.Add(-time.Second)}) // already expired
+	a.Add(3, ttlValue{V: 3})                     // never expires
+	var buf bytes.Buffer
+	if err := a.(Snapshotter).SaveTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// restored a little later
+	time.Sleep(10 * time.Millisecond)
+	b := NewLRUCache(10)
+	if err := b.(Snapshotter).LoadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+	Assert(b.Size() == 2 && b.Find(2) == nil, t)
+	left := time.Until(b.Find(1).(ttlValue).Expires)
+	Assert(left > time.Hour-time.Second && left <= time.Hour, t)
+	Assert(b.Find(3).(ttlValue).Expires.IsZero(), t)
+}
+
+// files written before ttls were added still load
+func TestSnapshot_V1(t *testing.T) {
+	var data []byte
+	data = append(data, snapshotMagic...)
+	data = binary.BigEndian.AppendUint16(data, snapshotVersionV1)
+	data = binary.BigEndian.AppendUint64(data, 1)
+	for _, v := range []interface{}{"k", "v"} {
+		item, _ := GobCodec.Marshal(v)
+		data = binary.AppendUvarint(data, uint64(len(item)))
+		data = append(data, item...)
+	}
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+
+	b := NewLRUCache(10)
+	Assert(b.(Snapshotter).LoadFrom(bytes.NewReader(data)) == nil, t)
+	Assert(b.Find("k") == "v", t)
+}
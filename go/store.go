@@ -0,0 +1,621 @@
+package lru
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// write-behind时Close之后的Add和Remove不会被执行，Err返回这个错误
+var ErrStoreClosed = errors.New("lru: store cache is closed")
+
+// 后端存储(数据的真正来源，比如数据库)
+type Store interface {
+	// load a key, nil value means the key does not exist
+	Load(k interface{}) (interface{}, error)
+
+	// store a key and value
+	Store(k, v interface{}) error
+
+	// delete a key
+	Delete(k interface{}) error
+}
+
+// 支持批量写入的后端存储，write-behind会优先使用
+type BatchStore interface {
+	Store
+
+	// store keys[i] and values[i] for every i
+	StoreBatch(keys, values []interface{}) error
+}
+
+// 缓存和后端存储的关系
+type StoreMode int
+
+const (
+	ReadThrough  StoreMode = 1 << iota // Find没命中时从后端加载
+	WriteThrough                       // Add/Remove同步写后端，写成功才更新缓存
+	WriteBehind                        // Add/Remove只标记为脏，后台批量写后端
+)
+
+type StoreOptions struct {
+	// read-through and one of write-through or write-behind
+	Mode StoreMode
+
+	// max number of entries in one write-behind batch, default is 100
+	BatchSize int
+
+	// how often the write-behind queue is flushed, default is 1s
+	FlushInterval time.Duration
+
+	// retries of a failed write before it is dropped, default is 3
+	MaxRetries int
+
+	// wait between retries, doubled after every retry, default is 10ms
+	RetryBackoff time.Duration
+}
+
+// 和后端存储关联的缓存
+type StoreCache interface {
+	LRUCache
+
+	// write every dirty entry to the store now
+	Flush() error
+
+	// the first store error since the cache was created
+	Err() error
+
+	// flush and stop the write-behind flusher, a second call does nothing
+	// in write-behind mode later Adds and Removes are dropped and Err returns ErrStoreClosed
+	Close() error
+}
+
+// 等待写回的修改，同一个key的多次修改合并成最后一次
+type pendingWrite struct {
+	v       lruValue
+	deleted bool
+}
+
+/**
+同一个key的后端写入串行执行
+每个写入在从dirty里取出(或者write-through开始)时在mu里拿一个递增的版本号
+拿到锁之后版本比written旧的写入直接丢掉，所以晚取出的值不会被早取出的值覆盖
+*/
+type keyLock struct {
+	sync.Mutex
+	refs    int    // 持有或者等待这个锁的写入数，在storeCache.mu里修改
+	written uint64 // 最后写到后端的版本，在这个锁里读写
+}
+
+// 正在从后端加载的key，gen在每次写这个key时加一，加载前后不一样说明加载到的值可能是旧的
+type storeLoad struct {
+	refs int
+	gen  uint64
+}
+
+// 一次后端写入
+type storeWrite struct {
+	k   lruKey
+	p   *pendingWrite
+	ver uint64
+	kl  *keyLock
+}
+
+/**
+关联后端存储的缓存
+内存层是threadUnsafeLRU，所有的操作都在mu里，后端写入都不在mu里
+write-behind时脏entry放在dirty里，queue记录变脏的顺序，后台协程按顺序批量写回
+脏entry被淘汰时移到inflight，释放mu之后同步写回再返回，保证淘汰后从后端读到的是最新的值
+write-through时持有key锁完成写后端和改缓存，同一个key的两个Add不会让缓存和后端不一致
+*/
+type storeCache struct {
+	mem   *threadUnsafeLRU
+	store Store
+	mode  StoreMode
+	batch int
+	every time.Duration
+	retry int
+	delay time.Duration
+
+	mu       sync.Mutex
+	dirty    map[lruKey]*pendingWrite // 还没写回的修改
+	inflight map[lruKey]*pendingWrite // 正在写回的修改
+	queue    []lruKey                 // 变脏的顺序
+	locks    map[lruKey]*keyLock      // 有写入的key的锁
+	seq      uint64                   // 写入的版本号
+	spilled  []*storeWrite            // 淘汰的脏entry，释放mu之后写回
+	loading  map[lruKey]*storeLoad    // 正在从后端加载的key
+	err      error
+	closed   bool
+
+	flushMu sync.Mutex // 同一时间只有一个flushBatch，它会同时持有多个key锁
+
+	kick chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewStoreCache(cap int, store Store, opts *StoreOptions) StoreCache {
+	if opts == nil {
+		opts = &StoreOptions{}
+	}
+	cache := &storeCache{
+		store:    store,
+		mode:     opts.Mode,
+		batch:    opts.BatchSize,
+		every:    opts.FlushInterval,
+		retry:    opts.MaxRetries,
+		delay:    opts.RetryBackoff,
+		dirty:    make(map[lruKey]*pendingWrite),
+		inflight: make(map[lruKey]*pendingWrite),
+		locks:    make(map[lruKey]*keyLock),
+		loading:  make(map[lruKey]*storeLoad),
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	if cache.mode&WriteThrough != 0 {
+		cache.mode &^= WriteBehind
+	}
+	if cache.batch <= 0 {
+		cache.batch = 100
+	}
+	if cache.every <= 0 {
+		cache.every = time.Second
+	}
+	if cache.retry <= 0 {
+		cache.retry = 3
+	}
+	if cache.delay <= 0 {
+		cache.delay = 10 * time.Millisecond
+	}
+	cache.mem = newThreadUnsafeLRU()
+	cache.mem.Create(cap)
+	cache.mem.SetOnEvict(cache.evicted)
+	if cache.mode&WriteBehind != 0 {
+		cache.wg.Add(1)
+		go cache.flusher()
+	}
+	return cache
+}
+
+func (cache *storeCache) Create(cap int) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for _, l := range cache.loading {
+		l.gen++
+	}
+	cache.mem.Create(cap)
+}
+
+/**
+添加一个元素
+write-through: 先写后端，成功了才放进缓存
+write-behind: 放进缓存并标记为脏
+*/
+func (cache *storeCache) Add(k lruKey, v lruValue) {
+	if cache.mode&WriteThrough != 0 {
+		w := cache.begin(k, &pendingWrite{v: v})
+		applied, err := cache.apply(w)
+		cache.mu.Lock()
+		cache.written(k)
+		if err != nil {
+			cache.fail(err)
+			// 后端写失败，缓存里旧的值也不能再用了
+			cache.mem.Remove(k)
+		} else if applied {
+			cache.mem.Add(k, v)
+		}
+		cache.end(w)
+		cache.unlockAndSpill()
+		return
+	}
+	cache.mu.Lock()
+	if cache.rejectLocked() {
+		cache.mu.Unlock()
+		return
+	}
+	cache.written(k)
+	cache.mem.Add(k, v)
+	if cache.mode&WriteBehind != 0 {
+		cache.markDirty(k, &pendingWrite{v: v})
+	}
+	cache.unlockAndSpill()
+}
+
+/**
+查找一个元素
+read-through时没命中会先看还没写回的修改，再从后端加载
+加载时不持有锁，同一个key可能会被同时加载多次
+加载期间这个key被Add、Remove或者Create过的话，加载到的值可能是旧的，不放进缓存，返回缓存里当前的值
+*/
+func (cache *storeCache) Find(k lruKey) lruValue {
+	cache.mu.Lock()
+	if v := cache.mem.Find(k); v != nil || cache.mode&ReadThrough == 0 {
+		cache.mu.Unlock()
+		return v
+	}
+	if p, ok := cache.pending(k); ok {
+		if !p.deleted {
+			cache.mem.Add(k, p.v)
+		}
+		cache.unlockAndSpill()
+		return p.v
+	}
+	l := cache.loading[k]
+	if l == nil {
+		l = &storeLoad{}
+		cache.loading[k] = l
+	}
+	l.refs++
+	gen := l.gen
+	cache.mu.Unlock()
+
+	v, err := cache.store.Load(k)
+	cache.mu.Lock()
+	if l.refs--; l.refs == 0 {
+		delete(cache.loading, k)
+	}
+	if l.gen != gen {
+		v := cache.mem.Find(k)
+		cache.mu.Unlock()
+		return v
+	}
+	if err != nil {
+		cache.fail(err)
+		cache.mu.Unlock()
+		return nil
+	}
+	if v == nil {
+		cache.mu.Unlock()
+		return nil
+	}
+	// 加载的时候可能已经有新的值了
+	if cur := cache.mem.Find(k); cur != nil {
+		cache.mu.Unlock()
+		return cur
+	}
+	if p, ok := cache.pending(k); ok {
+		cache.mu.Unlock()
+		return p.v
+	}
+	cache.mem.Add(k, v)
+	cache.unlockAndSpill()
+	return v
+}
+
+func (cache *storeCache) Size() int {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.mem.Size()
+}
+
+func (cache *storeCache) Remove(k lruKey) lruValue {
+	if cache.mode&WriteThrough != 0 {
+		w := cache.begin(k, &pendingWrite{deleted: true})
+		applied, err := cache.apply(w)
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		defer cache.end(w)
+		cache.written(k)
+		cache.fail(err)
+		if !applied && err == nil {
+			return nil // 已经被更新的Add覆盖了
+		}
+		return cache.mem.Remove(k)
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.rejectLocked() {
+		return nil
+	}
+	cache.written(k)
+	v := cache.mem.Remove(k)
+	if cache.mode&WriteBehind != 0 {
+		cache.markDirty(k, &pendingWrite{deleted: true})
+	}
+	return v
+}
+
+func (cache *storeCache) Iterator(reverse bool) *Iterator {
+	return newSliceIterator(cache.pairs(reverse))
+}
+
+func (cache *storeCache) Iter(reverse bool) <-chan lruPair {
+	return newSliceIterator(cache.pairs(reverse)).C
+}
+
+func (cache *storeCache) Flush() error {
+	for {
+		cache.mu.Lock()
+		n := len(cache.queue)
+		cache.mu.Unlock()
+		if n == 0 {
+			break
+		}
+		cache.flushBatch()
+	}
+	return cache.Err()
+}
+
+func (cache *storeCache) Err() error {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.err
+}
+
+// 第二次调用什么都不做
+func (cache *storeCache) Close() error {
+	cache.mu.Lock()
+	if cache.closed {
+		cache.mu.Unlock()
+		return nil
+	}
+	cache.closed = true
+	cache.mu.Unlock()
+	if cache.mode&WriteBehind != 0 {
+		close(cache.stop)
+		cache.wg.Wait()
+	}
+	return cache.Flush()
+}
+
+// write-behind时Close之后拒绝写入，在mu里调用
+func (cache *storeCache) rejectLocked() bool {
+	if cache.closed && cache.mode&WriteBehind != 0 {
+		cache.fail(ErrStoreClosed)
+		return true
+	}
+	return false
+}
+
+// k被写过，正在加载的值不能再放进缓存，在mu里调用
+func (cache *storeCache) written(k lruKey) {
+	if l := cache.loading[k]; l != nil {
+		l.gen++
+	}
+}
+
+// 标记为脏，合并同一个key的多次修改
+func (cache *storeCache) markDirty(k lruKey, p *pendingWrite) {
+	if _, ok := cache.dirty[k]; !ok {
+		cache.queue = append(cache.queue, k)
+	}
+	cache.dirty[k] = p
+	if len(cache.queue) >= cache.batch {
+		select {
+		case cache.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// 还没写回或者正在写回的修改
+func (cache *storeCache) pending(k lruKey) (*pendingWrite, bool) {
+	if p, ok := cache.dirty[k]; ok {
+		return p, true
+	}
+	p, ok := cache.inflight[k]
+	return p, ok
+}
+
+/**
+淘汰回调，在mu里调用
+脏entry移到inflight(Find还能读到)，由unlockAndSpill在mu外面写回
+*/
+func (cache *storeCache) evicted(k, v interface{}) {
+	p, ok := cache.dirty[k]
+	if !ok || p.deleted {
+		return
+	}
+	delete(cache.dirty, k)
+	cache.inflight[k] = p
+	cache.spilled = append(cache.spilled, cache.take(k, p))
+}
+
+/**
+释放mu，然后同步写回这次操作淘汰的脏entry
+可能淘汰entry的操作(往mem里Add)都用它来解锁
+*/
+func (cache *storeCache) unlockAndSpill() {
+	writes := cache.spilled
+	cache.spilled = nil
+	cache.mu.Unlock()
+	if len(writes) == 0 {
+		return
+	}
+	var err error
+	for _, w := range writes {
+		if _, e := cache.apply(w); e != nil && err == nil {
+			err = e
+		}
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for _, w := range writes {
+		cache.end(w)
+	}
+	cache.fail(err)
+}
+
+/**
+取出一个要写的修改，在mu里调用
+版本号按取出的顺序递增
+*/
+func (cache *storeCache) take(k lruKey, p *pendingWrite) *storeWrite {
+	kl := cache.locks[k]
+	if kl == nil {
+		kl = &keyLock{}
+		cache.locks[k] = kl
+	}
+	kl.refs++
+	cache.seq++
+	return &storeWrite{k: k, p: p, ver: cache.seq, kl: kl}
+}
+
+// write-through用，取出修改并拿到key锁，之后要调用end并释放key锁
+func (cache *storeCache) begin(k lruKey, p *pendingWrite) *storeWrite {
+	cache.mu.Lock()
+	w := cache.take(k, p)
+	cache.mu.Unlock()
+	w.kl.Lock()
+	return w
+}
+
+/**
+写完了，在mu里调用
+begin拿到的key锁也在这里释放
+*/
+func (cache *storeCache) end(w *storeWrite) {
+	if cache.inflight[w.k] == w.p {
+		delete(cache.inflight, w.k)
+	}
+	if cache.mode&WriteThrough != 0 {
+		w.kl.Unlock()
+	}
+	w.kl.refs--
+	if w.kl.refs == 0 {
+		delete(cache.locks, w.k)
+	}
+}
+
+/**
+写一个修改到后端，不在mu里调用
+write-through时调用者已经持有key锁(begin)，否则在这里拿
+return: 是否写了，比已经写过的版本旧的不写
+*/
+func (cache *storeCache) apply(w *storeWrite) (bool, error) {
+	if cache.mode&WriteThrough == 0 {
+		w.kl.Lock()
+		defer w.kl.Unlock()
+	}
+	if w.ver <= w.kl.written {
+		return false, nil
+	}
+	w.kl.written = w.ver
+	return true, cache.write(w.k, w.p)
+}
+
+func (cache *storeCache) flusher() {
+	defer cache.wg.Done()
+	ticker := time.NewTicker(cache.every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-cache.kick:
+		case <-ticker.C:
+		case <-cache.stop:
+			return
+		}
+		cache.flushBatch()
+	}
+}
+
+/**
+写回一批
+按变脏的顺序取出最多batch个，能批量写的用StoreBatch，删除逐个写
+*/
+func (cache *storeCache) flushBatch() {
+	cache.flushMu.Lock()
+	defer cache.flushMu.Unlock()
+
+	cache.mu.Lock()
+	batch := make([]*storeWrite, 0, cache.batch)
+	for len(cache.queue) > 0 && len(batch) < cache.batch {
+		k := cache.queue[0]
+		cache.queue[0] = nil
+		cache.queue = cache.queue[1:]
+		p, ok := cache.dirty[k]
+		if !ok {
+			continue // 淘汰的时候已经写回了
+		}
+		delete(cache.dirty, k)
+		cache.inflight[k] = p
+		batch = append(batch, cache.take(k, p))
+	}
+	cache.mu.Unlock()
+
+	// 一批里的key各不相同，flushMu保证只有这里会同时持有多个key锁，不会死锁
+	keys := make([]interface{}, 0, len(batch))
+	values := make([]interface{}, 0, len(batch))
+	deletes := make([]interface{}, 0)
+	for _, w := range batch {
+		w.kl.Lock()
+		if w.ver <= w.kl.written {
+			continue // 已经有更新的值写回了
+		}
+		w.kl.written = w.ver
+		if w.p.deleted {
+			deletes = append(deletes, w.k)
+		} else {
+			keys = append(keys, w.k)
+			values = append(values, w.p.v)
+		}
+	}
+
+	var err error
+	if bs, ok := cache.store.(BatchStore); ok && len(keys) > 1 {
+		err = cache.retryWrite(func() error { return bs.StoreBatch(keys, values) })
+	} else {
+		for i, k := range keys {
+			if e := cache.write(k, &pendingWrite{v: values[i]}); e != nil && err == nil {
+				err = e
+			}
+		}
+	}
+	for _, k := range deletes {
+		if e := cache.write(k, &pendingWrite{deleted: true}); e != nil && err == nil {
+			err = e
+		}
+	}
+	for _, w := range batch {
+		w.kl.Unlock()
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	for _, w := range batch {
+		cache.end(w)
+	}
+	cache.fail(err)
+}
+
+// 写一个修改到后端，失败会重试
+func (cache *storeCache) write(k lruKey, p *pendingWrite) error {
+	return cache.retryWrite(func() error {
+		if p.deleted {
+			return cache.store.Delete(k)
+		}
+		return cache.store.Store(k, p.v)
+	})
+}
+
+func (cache *storeCache) retryWrite(fn func() error) error {
+	delay := cache.delay
+	var err error
+	for i := 0; i <= cache.retry; i++ {
+		if err = fn(); err == nil {
+			return nil
+		}
+		if i < cache.retry {
+			time.Sleep(delay)
+			delay *= 2
+		}
+	}
+	return err
+}
+
+func (cache *storeCache) fail(err error) {
+	if err != nil && cache.err == nil {
+		cache.err = err
+	}
+}
+
+func (cache *storeCache) pairs(reverse bool) []lruPair {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	pairs := cache.mem.pairs()
+	if !reverse {
+		reversePairs(pairs)
+	}
+	return pairs
+}
@@ -0,0 +1,312 @@
+package lru
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// in-memory system of record
+type memStore struct {
+	data    map[interface{}]interface{}
+	loads   int
+	writes  int
+	batches int
+	fails   int // fail the next n writes
+	sync.Mutex
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[interface{}]interface{})}
+}
+
+var errStore = errors.New("store down")
+
+func (s *memStore) Load(k interface{}) (interface{}, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.loads++
+	return s.data[k], nil
+}
+
+func (s *memStore) Store(k, v interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+	if s.fails > 0 {
+		s.fails--
+		return errStore
+	}
+	s.writes++
+	s.data[k] = v
+	return nil
+}
+
+func (s *memStore) Delete(k interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+	s.writes++
+	delete(s.data, k)
+	return nil
+}
+
+func (s *memStore) get(k interface{}) interface{} {
+	s.Lock()
+	defer s.Unlock()
+	return s.data[k]
+}
+
+type memBatchStore struct {
+	*memStore
+}
+
+func (s memBatchStore) StoreBatch(keys, values []interface{}) error {
+	s.Lock()
+	defer s.Unlock()
+	s.batches++
+	for i, k := range keys {
+		s.data[k] = values[i]
+	}
+	return nil
+}
+
+func TestStoreCache_ReadThrough(t *testing.T) {
+	s := newMemStore()
+	s.data[1] = "one"
+	a := NewStoreCache(10, s, &StoreOptions{Mode: ReadThrough})
+	defer a.Close()
+
+	Assert(a.Find(1) == "one", t)
+	Assert(a.Find(1) == "one", t)
+	Assert(s.loads == 1, t)
+	Assert(a.Find(2) == nil, t)
+	Assert(a.Size() == 1, t)
+
+	// without write modes the store is never written
+	a.Add(3, 3)
+	Assert(s.get(3) == nil, t)
+}
+
+func TestStoreCache_WriteThrough(t *testing.T) {
+	s := newMemStore()
+	a := NewStoreCache(10, s, &StoreOptions{Mode: ReadThrough | WriteThrough, RetryBackoff: time.Microsecond})
+	defer a.Close()
+
+	a.Add(1, "one")
+	Assert(s.get(1) == "one", t)
+	Assert(a.Remove(1) == "one", t)
+	Assert(s.get(1) == nil, t)
+
+	// retried until it succeeds
+	s.fails = 2
+	a.Add(2, "two")
+	Assert(s.get(2) == "two", t)
+	Assert(a.Err() == nil, t)
+
+	// the store keeps failing: the cache is not updated
+	s.fails = 10
+	a.Add(2, "2")
+	Assert(a.Err() == errStore, t)
+	s.fails = 0
+	Assert(a.Find(2) == "two", t)
+}
+
+func TestStoreCache_WriteBehind(t *testing.T) {
+	s := newMemStore()
+	a := NewStoreCache(10, s, &StoreOptions{Mode: ReadThrough | WriteBehind, FlushInterval: time.Hour})
+
+	for i := 0; i < 5; i++ {
+		a.Add(1, i) // coalesced into one write
+	}
+	a.Add(2, 2)
+	a.Remove(2)
+	Assert(s.get(1) == nil, t)
+
+	Assert(a.Flush() == nil, t)
+	Assert(s.get(1) == 4, t)
+	Assert(s.writes == 2, t) // one store, one delete
+	Assert(a.Close() == nil, t)
+}
+
+func TestStoreCache_WriteBehind_Batch(t *testing.T) {
+	s := memBatchStore{newMemStore()}
+	a := NewStoreCache(100, s, &StoreOptions{Mode: WriteBehind, BatchSize: 10, FlushInterval: time.Hour})
+
+	for i := 0; i < 25; i++ {
+		a.Add(i, i)
+	}
+	Assert(a.Close() == nil, t)
+	Assert(s.batches == 3, t)
+	for i := 0; i < 25; i++ {
+		Assert(s.get(i) == i, t)
+	}
+}
+
+// dirty entries are written before they leave the list
+func TestStoreCache_WriteBehind_Evict(t *testing.T) {
+	s := newMemStore()
+	a := NewStoreCache(2, s, &StoreOptions{Mode: ReadThrough | WriteBehind, FlushInterval: time.Hour})
+	defer a.Close()
+
+	a.Add(1, "one")
+	a.Add(2, "two")
+	Assert(s.get(1) == nil, t)
+	a.Add(3, "three") // evicts 1
+	Assert(s.get(1) == "one", t)
+	Assert(s.get(2) == nil, t)
+
+	Assert(a.Find(1) == "one", t)
+}
+
+func TestStoreCache_WriteBehind_Pending(t *testing.T) {
+	s := newMemStore()
+	s.data[1] = "old"
+	a := NewStoreCache(1, s, &StoreOptions{Mode: ReadThrough | WriteBehind, FlushInterval: time.Hour})
+	defer a.Close()
+
+	a.Add(1, "new")
+	a.Remove(1)
+	// the pending delete wins over the stale store
+	Assert(a.Find(1) == nil, t)
+	Assert(s.loads == 0, t)
+}
+
+// a store whose writes of one value block until released
+type gatedStore struct {
+	*memStore
+	value   interface{}
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *gatedStore) Store(k, v interface{}) error {
+	if v == s.value {
+		close(s.entered)
+		<-s.release
+	}
+	return s.memStore.Store(k, v)
+}
+
+// an older write still in flight does not land after a newer one,
+// and the eviction write does not hold the cache lock
+func TestStoreCache_WriteBehind_Order(t *testing.T) {
+	s := &gatedStore{memStore: newMemStore(), value: "v1", entered: make(chan struct{}), release: make(chan struct{})}
+	a := NewStoreCache(1, s, &StoreOptions{Mode: ReadThrough | WriteBehind, FlushInterval: time.Hour})
+	defer a.Close()
+
+	a.Add("k", "v1")
+	flushed := make(chan struct{})
+	go func() {
+		a.Flush()
+		close(flushed)
+	}()
+	<-s.entered // v1 is in flight
+
+	a.Add("k", "v2")
+	added := make(chan struct{})
+	go func() {
+		a.Add("j", "x") // evicts k, its write waits for v1
+		close(added)
+	}()
+	select {
+	case <-added:
+		t.Fatal("eviction write did not wait for the in-flight write")
+	case <-time.After(20 * time.Millisecond):
+	}
+	// readers are not blocked meanwhile
+	done := make(chan struct{})
+	go func() {
+		a.Size()
+		a.Find("k")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("cache lock held during a store write")
+	}
+
+	close(s.release)
+	<-flushed
+	<-added
+	Assert(s.get("k") == "v2", t)
+	Assert(a.Find("k") == "v2", t)
+	Assert(a.Err() == nil, t)
+}
+
+// concurrent write-through Adds leave the store and the cache agreeing
+func TestStoreCache_WriteThrough_Concurrent(t *testing.T) {
+	s := newMemStore()
+	a := NewStoreCache(10, s, &StoreOptions{Mode: ReadThrough | WriteThrough})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				a.Add("k", g*1000+i)
+				if i%10 == 0 {
+					a.Remove("k")
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	Assert(a.Find("k") == s.get("k"), t)
+	Assert(a.Close() == nil, t)
+	Assert(a.Close() == nil, t)
+}
+
+func TestStoreCache_CloseTwice(t *testing.T) {
+	a := NewStoreCache(10, newMemStore(), &StoreOptions{Mode: ReadThrough | WriteBehind})
+	a.Add(1, 1)
+	Assert(a.Close() == nil, t)
+	Assert(a.Close() == nil, t)
+}
+
+// a store whose first Load blocks until released
+type slowLoadStore struct {
+	*memStore
+	once    sync.Once
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (s *slowLoadStore) Load(k interface{}) (interface{}, error) {
+	v, err := s.memStore.Load(k)
+	s.once.Do(func() {
+		close(s.entered)
+		<-s.release
+	})
+	return v, err
+}
+
+// a write landing while a read-through load is running wins over the loaded value
+func TestStoreCache_ReadThrough_StaleLoad(t *testing.T) {
+	s := &slowLoadStore{memStore: newMemStore(), entered: make(chan struct{}), release: make(chan struct{})}
+	s.data[1] = "old"
+	a := NewStoreCache(10, s, &StoreOptions{Mode: ReadThrough | WriteThrough})
+	defer a.Close()
+
+	got := make(chan interface{})
+	go func() { got <- a.Find(1) }()
+	<-s.entered // "old" is loaded
+	Assert(a.Remove(1) == nil, t)
+	close(s.release)
+	Assert(<-got == nil, t)
+	Assert(a.Size() == 0, t)
+	Assert(a.Find(1) == nil, t)
+}
+
+// writes after Close are not queued and lost silently
+func TestStoreCache_WriteBehind_AfterClose(t *testing.T) {
+	s := newMemStore()
+	a := NewStoreCache(10, s, &StoreOptions{Mode: ReadThrough | WriteBehind})
+	a.Add(1, 1)
+	Assert(a.Close() == nil, t)
+	a.Add(2, 2)
+	a.Remove(1)
+	Assert(a.Err() == ErrStoreClosed, t)
+	Assert(a.Find(2) == nil, t)
+	Assert(s.get(1) == 1, t)
+}
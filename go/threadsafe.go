@@ -23,7 +23,12 @@ func newThreadSafeLRU() *threadSafeLRU {
 cap: 容量，缓存最多存多少数据
 */
 func (cache *threadSafeLRU) Create(cap int) {
-	cache.c = newThreadUnsafeLRU()
+	cache.Lock()
+	defer cache.Unlock()
+	// 重新创建时复用，保留SetOnEvict设置的回调
+	if cache.c == nil {
+		cache.c = newThreadUnsafeLRU()
+	}
 	cache.c.Create(cap)
 }
 
@@ -78,72 +83,67 @@ func (cache *threadSafeLRU) Remove(k lruKey) lruValue {
 	return cache.c.Remove(k)
 }
 
+/**
+设置淘汰回调
+回调在持有锁的时候调用，回调里不能再调用这个cache的方法
+*/
+func (cache *threadSafeLRU) SetOnEvict(fn func(k, v interface{})) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.c.SetOnEvict(fn)
+}
+
+// 设置空闲node链表的上限
+func (cache *threadSafeLRU) SetPoolSize(n int) {
+	cache.Lock()
+	defer cache.Unlock()
+	cache.c.SetPoolSize(n)
+}
+
+/**
+删除所有fn返回true的entry
+整个过程持有写锁，fn和淘汰回调里不能调用这个cache
+*/
+func (cache *threadSafeLRU) RemoveIf(fn func(k, v interface{}) bool) int {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.RemoveIf(fn)
+}
+
+// 从头部开始淘汰，直到pred返回false，持有写锁
+func (cache *threadSafeLRU) EvictWhile(pred func(k, v interface{}) bool) int {
+	cache.Lock()
+	defer cache.Unlock()
+	return cache.c.EvictWhile(pred)
+}
+
 /**
 遍历缓存中所有的数据的迭代器
+在读锁里一次拷贝进channel的缓冲，之后遍历的时候不持有锁，也不需要协程
 reverse: 是否翻转 true = 正序 false = 倒序(默认，淘汰的是从头部，所以从后往前是默认)
 return: 迭代器 func
 */
 func (cache *threadSafeLRU) Iterator(reverse bool) *Iterator {
-	iterator, ch, stopCh := newIterator(cache.c.cap)
-	go func() {
-		cache.RLock()
-		defer cache.RUnlock()
-		if cache.c.len == 0 {
-			close(ch)
-			return
-		}
-		if reverse {
-			p := cache.c.head.next
-		LT:
-			for p != cache.c.tail && p != nil {
-				select {
-				case <-stopCh:
-					break LT
-				case ch <- lruPair{p.key, p.value}:
-				}
-				p = p.next
-			}
-		} else {
-			p := cache.c.tail.prev
-		LF:
-			for p != cache.c.head {
-				select {
-				case <-stopCh:
-					break LF
-				case ch <- lruPair{p.key, p.value}:
-				}
-				p = p.prev
-			}
-		}
-		close(ch)
-	}()
-	return iterator
+	cache.RLock()
+	defer cache.RUnlock()
+	return cache.c.Iterator(reverse)
 }
 
 func (cache *threadSafeLRU) Iter(reverse bool) <-chan lruPair {
-	ch := make(chan lruPair, cache.c.cap) // 这里需要设置channel大小
-	go func() {
-		cache.RLock()
-		defer cache.RUnlock()
-		if cache.c.len == 0 {
-			close(ch)
-			return
-		}
-		if reverse {
-			p := cache.c.head.next
-			for p != cache.c.tail {
-				ch <- lruPair{p.key, p.value}
-				p = p.next
-			}
-		} else {
-			p := cache.c.tail.prev
-			for p != cache.c.head {
-				ch <- lruPair{p.key, p.value}
-				p = p.prev
-			}
-		}
-		close(ch)
-	}()
-
-	return ch
+	return cache.Iterator(reverse).C
+}
+
+/**
+遍历所有entry，fn返回false时停止
+整个遍历持有读锁，fn里不能调用这个cache(Find要写锁，会死锁)
+*/
+func (cache *threadSafeLRU) Range(reverse bool, fn func(k, v interface{}) bool) {
+	cache.RLock()
+	defer cache.RUnlock()
+	cache.c.Range(reverse, fn)
+}
+
+// 拉取式的游标，每次Next只短暂持有读锁，遍历途中其他协程可以修改缓存
+func (cache *threadSafeLRU) Cursor(reverse bool) *Cursor {
+	return newCursor(cache.c, cache.RLocker(), reverse)
 }
@@ -237,3 +237,36 @@ func TestThreadSafeLRU(t *testing.T) {
 
 	Assert(a.Size() > 450, t)
 }
+
+// Create reuses the inner cache, so the SetOnEvict callback survives a flush
+func TestThreadSafeLRU_Create_KeepsOnEvict(t *testing.T) {
+	a := NewLRUCache(2)
+	evicted := 0
+	a.(Evictable).SetOnEvict(func(k, v interface{}) { evicted++ })
+	a.Create(2)
+	for i := 0; i < 5; i++ {
+		a.Add(i, i)
+	}
+	Assert(evicted == 3, t)
+}
+
+// Create takes the lock, run with -race
+func TestThreadSafeLRU_Create_Concurrent(t *testing.T) {
+	a := NewLRUCache(100)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if g == 0 && i%100 == 0 {
+					a.Create(100)
+				}
+				a.Add(i, i)
+				a.Find(i - 1)
+			}
+		}(g)
+	}
+	wg.Wait()
+	Assert(a.Size() <= 100, t)
+}
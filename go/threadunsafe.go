@@ -9,6 +9,7 @@ type lruNode struct {
 	prev  *lruNode // 前指针
 	value lruValue // 缓存的值
 	key   lruKey   // 缓存的key
+	seq   uint64   // 放进链表时缓存的mod，游标用它区分开始遍历之后才加入或者移动过的node
 }
 
 /**
@@ -17,16 +18,28 @@ LRU 缓存
 可将查找、添加等操作的时间复杂度较少到O(1) (理论上，取决于map的实现)
 */
 type threadUnsafeLRU struct {
-	head *lruNode            // 头指针
-	tail *lruNode            // 尾指针
-	dict map[lruKey]*lruNode // 存放数据的 map，提高查找效率
-	len  int                 // 当前数量
-	cap  int                 // 总量
-	pool []*lruNode          // node的对象池，减少gc
+	head  *lruNode            // 头指针
+	tail  *lruNode            // 尾指针
+	dict  map[lruKey]*lruNode // 存放数据的 map，提高查找效率
+	len   int                 // 当前数量
+	cap   int                 // 总量
+	codec Codec               // 快照用的编解码器，nil时用gob
+
+	free     *lruNode // 空闲node的链表，用next串起来，减少gc
+	nfree    int      // 空闲链表的长度
+	poolSize int      // 空闲链表最多保留多少node
+
+	onEvict func(k, v interface{}) // 容量满了淘汰entry时的回调
+
+	mod uint64 // 链表的修改次数，新node的seq取这个值
 }
 
+// 默认保留的空闲node数
+// 满了之后的Add是先淘汰再添加，移动node是先释放再添加，都只需要一个空闲node
+const defaultPoolSize = 16
+
 func newThreadUnsafeLRU() *threadUnsafeLRU {
-	return &threadUnsafeLRU{}
+	return &threadUnsafeLRU{poolSize: defaultPoolSize}
 }
 
 /**
@@ -52,7 +65,9 @@ func (cache *threadUnsafeLRU) Create(cap int) {
 	cache.dict = make(map[lruKey]*lruNode) // init map
 	cache.len = 0
 	cache.cap = cap
-	cache.pool = make([]*lruNode, 0, 1) // 大设1吧，理论上不会超过这个值
+	cache.free = nil
+	cache.nfree = 0
+	cache.mod++
 }
 
 /**
@@ -106,70 +121,113 @@ func (cache *threadUnsafeLRU) Remove(k lruKey) lruValue {
 	return cache.poptail(k)
 }
 
+/**
+设置淘汰回调
+容量满了从头部淘汰entry，还有RemoveIf和EvictWhile删除entry时调用，Remove不会调用
+*/
+func (cache *threadUnsafeLRU) SetOnEvict(fn func(k, v interface{})) {
+	cache.onEvict = fn
+}
+
+/**
+设置空闲node链表的上限
+Remove多的时候空闲node会变多，超过上限的交给gc
+n: 0表示不缓存空闲node
+*/
+func (cache *threadUnsafeLRU) SetPoolSize(n int) {
+	if n < 0 {
+		n = 0
+	}
+	cache.poolSize = n
+	for cache.nfree > n {
+		node := cache.free
+		cache.free = node.next
+		node.next = nil
+		cache.nfree--
+	}
+}
+
 /**
 遍历缓存中所有的数据的迭代器
+直接拷贝进channel的缓冲，不需要协程，遍历的时候可以修改缓存
 reverse: 是否翻转 true = 正序 false = 倒序(默认，淘汰的是从头部，所以从后往前是默认)
 return: 迭代器 func
 */
 func (cache *threadUnsafeLRU) Iterator(reverse bool) *Iterator {
-	iterator, ch, stopCh := newIterator(cache.cap)
-	go func() {
-		if cache.len == 0 {
-			close(ch)
-			return
-		}
-		if reverse {
-			p := cache.head.next
-		LT:
-			for p != cache.tail {
-				select {
-				case <-stopCh:
-					break LT
-				case ch <- lruPair{p.key, p.value}:
-				}
-				p = p.next
-			}
-		} else {
-			p := cache.tail.prev
-		LF:
-			for p != cache.head {
-				select {
-				case <-stopCh:
-					break LF
-				case ch <- lruPair{p.key, p.value}:
-				}
-				p = p.prev
-			}
-		}
-		close(ch)
-	}()
+	iterator, ch, _ := newIterator(cache.len)
+	cache.Range(reverse, func(k, v interface{}) bool {
+		ch <- lruPair{k, v}
+		return true
+	})
+	close(ch)
 	return iterator
 }
 
 func (cache *threadUnsafeLRU) Iter(reverse bool) <-chan lruPair {
-	ch := make(chan lruPair, cache.cap)
-	go func() {
-		if cache.len == 0 {
-			close(ch)
-			return
-		}
-		if reverse {
-			p := cache.head.next
-			for p != cache.tail {
-				ch <- lruPair{p.key, p.value}
-				p = p.next
+	return cache.Iterator(reverse).C
+}
+
+/**
+遍历所有entry，fn返回false时停止
+直接走链表，fn里不能修改缓存，需要修改的话用Cursor
+*/
+func (cache *threadUnsafeLRU) Range(reverse bool, fn func(k, v interface{}) bool) {
+	if cache.len == 0 {
+		return
+	}
+	if reverse {
+		for p := cache.head.next; p != cache.tail; p = p.next {
+			if !fn(p.key, p.value) {
+				return
 			}
-		} else {
-			p := cache.tail.prev
-			for p != cache.head {
-				ch <- lruPair{p.key, p.value}
-				p = p.prev
+		}
+	} else {
+		for p := cache.tail.prev; p != cache.head; p = p.prev {
+			if !fn(p.key, p.value) {
+				return
 			}
 		}
-		close(ch)
-	}()
+	}
+}
+
+/**
+删除所有fn返回true的entry，从旧到新走一遍链表
+每删除一个都会调用淘汰回调，fn和回调里都不能修改缓存
+return: 删除的数量
+*/
+func (cache *threadUnsafeLRU) RemoveIf(fn func(k, v interface{}) bool) int {
+	if cache.len == 0 {
+		return 0
+	}
+	n := 0
+	for p := cache.head.next; p != cache.tail; {
+		next := p.next // freenode会清空p的指针，先记下来
+		if fn(p.key, p.value) {
+			cache.evictnode(p)
+			n++
+		}
+		p = next
+	}
+	return n
+}
 
-	return ch
+/**
+从头部(最旧的)开始淘汰，直到pred返回false或者缓存空了
+每淘汰一个都会调用淘汰回调
+return: 淘汰的数量
+*/
+func (cache *threadUnsafeLRU) EvictWhile(pred func(k, v interface{}) bool) int {
+	n := 0
+	for cache.len > 0 && pred(cache.head.next.key, cache.head.next.value) {
+		cache.evictnode(cache.head.next)
+		n++
+	}
+	return n
+}
+
+// 拉取式的游标，遍历途中可以修改缓存
+func (cache *threadUnsafeLRU) Cursor(reverse bool) *Cursor {
+	return newCursor(cache, nil, reverse)
 }
 
 /**
@@ -190,15 +248,7 @@ func (cache *threadUnsafeLRU) add(k lruKey, v lruValue, notinc bool) {
 			// 如果n特别特别大，那么这一次的操作会非常耗时。平均是O(2)
 			// 如果改回满了，删一次，那么满了之后的增加多了一次删除操作，大约是O(2)
 			// 综上，还是选择每次删除一个。
-			expires := 1
-			//for i := 0; i < expires; i++ {
-			rmnode := cache.head.next
-			rmkey := rmnode.key       // 找到对应的key
-			delete(cache.dict, rmkey) // 一定要把map里的key给删除
-
-			cache.freenode(rmnode)
-			//}
-			cache.len -= expires // size减小到删除后的真实size
+			cache.evictnode(cache.head.next)
 		}
 	}
 	// 创建node，并添加到尾部和map中
@@ -209,6 +259,21 @@ func (cache *threadUnsafeLRU) add(k lruKey, v lruValue, notinc bool) {
 	cache.dict[k] = node
 }
 
+/**
+淘汰一个node
+从map和链表里删除，size减一，然后通知回调
+*/
+func (cache *threadUnsafeLRU) evictnode(node *lruNode) {
+	rmkey := node.key         // 找到对应的key
+	delete(cache.dict, rmkey) // 一定要把map里的key给删除
+
+	rmvalue := cache.freenode(node)
+	cache.len-- // size减小到删除后的真实size
+	if cache.onEvict != nil {
+		cache.onEvict(rmkey, rmvalue) // 通知被淘汰的entry
+	}
+}
+
 /**
 内置查找方法
 cache: 缓存
@@ -256,19 +321,22 @@ func (cache *threadUnsafeLRU) poptail(k lruKey) lruValue {
 
 /**
 新建node
-使用了对象池，减少对象的创建
+优先从空闲链表里取，减少对象的创建
 提高运行效率
 同时减少了gc
 */
 func (cache *threadUnsafeLRU) newnode(k lruKey, v lruValue, next, prev *lruNode) *lruNode {
-	if len(cache.pool) > 0 {
-		// 从头部去出一个node
-		node := cache.pool[0]
-		cache.pool = cache.pool[1:]
+	cache.mod++
+	if cache.free != nil {
+		// 从空闲链表头部取出一个node
+		node := cache.free
+		cache.free = node.next
+		cache.nfree--
 		node.key = k
 		node.value = v
 		node.prev = prev
 		node.next = next
+		node.seq = cache.mod
 
 		return node
 	}
@@ -278,6 +346,7 @@ func (cache *threadUnsafeLRU) newnode(k lruKey, v lruValue, next, prev *lruNode)
 		prev:  prev,
 		value: v,
 		key:   k,
+		seq:   cache.mod,
 	}
 	return node
 }
@@ -288,6 +357,7 @@ func (cache *threadUnsafeLRU) newnode(k lruKey, v lruValue, next, prev *lruNode)
 */
 func (cache *threadUnsafeLRU) freenode(node *lruNode) lruValue {
 	// 把指针操作也放到里面
+	cache.mod++
 	node.next.prev = node.prev
 	node.prev.next = node.next
 	v := node.value
@@ -298,7 +368,12 @@ func (cache *threadUnsafeLRU) freenode(node *lruNode) lruValue {
 	node.key = nil
 	node.next = nil
 	node.prev = nil
-	cache.pool = append(cache.pool, node)
+	// 放回空闲链表，空闲链表满了就交给gc
+	if cache.nfree < cache.poolSize {
+		node.next = cache.free
+		cache.free = node
+		cache.nfree++
+	}
 	return v
 }
 
@@ -0,0 +1,173 @@
+package lru
+
+import "sync"
+
+// 两层缓存之间entry的放置方式
+type Placement int
+
+const (
+	// every entry added is in L2, L1 holds copies of the hot ones
+	Inclusive Placement = iota
+
+	// an entry is in only one layer, L1 evictions are demoted to L2
+	Exclusive
+)
+
+/**
+L1/L2 两层缓存
+L1一般是小的、每组协程自己的缓存，L2是大的、共享的缓存
+Find先查L1，没命中查L2，L2命中提升到L1
+Inclusive: Add同时写两层，L2命中时复制到L1
+Exclusive: Add只写L1，L2命中时移到L1，L1满了淘汰的entry降级到L2
+	降级需要L1实现Evictable(NewLRUCache返回的就可以)，否则淘汰的entry直接丢掉
+Remove两层都删
+*/
+type Tiered struct {
+	l1        LRUCache
+	l2        LRUCache
+	l1Cap     int // 创建时两层的容量，不认识的缓存是0
+	l2Cap     int
+	placement Placement
+	sync.Mutex
+}
+
+func NewTiered(l1, l2 LRUCache, placement Placement) *Tiered {
+	tiered := &Tiered{l1: l1, l2: l2, l1Cap: capacityOf(l1), l2Cap: capacityOf(l2), placement: placement}
+	if e, ok := l1.(Evictable); ok && placement == Exclusive {
+		e.SetOnEvict(tiered.demote)
+	}
+	return tiered
+}
+
+/**
+重新创建两层
+L1的容量是cap，L2按创建时两层容量的比例缩放，所以传L1原来的容量时两层都保持原来的大小
+不知道容量的缓存(不是这个包里的LRU)两层都用cap
+*/
+func (cache *Tiered) Create(cap int) {
+	cache.Lock()
+	defer cache.Unlock()
+	l2Cap := cap
+	if cache.l1Cap > 0 && cache.l2Cap > 0 {
+		l2Cap = int(int64(cap) * int64(cache.l2Cap) / int64(cache.l1Cap))
+	}
+	cache.l1.Create(cap)
+	cache.l2.Create(l2Cap)
+}
+
+// 这个包里LRU缓存的容量，不认识的缓存返回0
+func capacityOf(c LRUCache) int {
+	switch c := c.(type) {
+	case *threadSafeLRU:
+		c.RLock()
+		defer c.RUnlock()
+		return c.c.cap
+	case *threadUnsafeLRU:
+		return c.cap
+	case *concurrentLRU:
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.cap
+	case *threadSafeSampledLRU:
+		c.Lock()
+		defer c.Unlock()
+		return c.c.cap
+	case *threadUnsafeSampledLRU:
+		return c.cap
+	}
+	return 0
+}
+
+func (cache *Tiered) Add(k lruKey, v lruValue) {
+	cache.Lock()
+	defer cache.Unlock()
+	if cache.placement == Inclusive {
+		cache.l2.Add(k, v)
+	} else {
+		cache.l2.Remove(k)
+	}
+	cache.l1.Add(k, v)
+}
+
+func (cache *Tiered) Find(k lruKey) lruValue {
+	cache.Lock()
+	defer cache.Unlock()
+	if v := cache.l1.Find(k); v != nil {
+		return v
+	}
+	v := cache.l2.Find(k)
+	if v == nil {
+		return nil
+	}
+	// 提升到L1
+	if cache.placement == Exclusive {
+		cache.l2.Remove(k)
+	}
+	cache.l1.Add(k, v)
+	return v
+}
+
+/**
+entry的数量
+Exclusive: 两层之和
+Inclusive: L2的数量，L2已经淘汰但L1里还有的entry不算在内
+*/
+func (cache *Tiered) Size() int {
+	cache.Lock()
+	defer cache.Unlock()
+	if cache.placement == Inclusive {
+		return cache.l2.Size()
+	}
+	return cache.l1.Size() + cache.l2.Size()
+}
+
+// 两层都删，返回L1的值(L1没有时返回L2的值)
+func (cache *Tiered) Remove(k lruKey) lruValue {
+	cache.Lock()
+	defer cache.Unlock()
+	v1 := cache.l1.Remove(k)
+	v2 := cache.l2.Remove(k)
+	if v1 != nil {
+		return v1
+	}
+	return v2
+}
+
+/**
+遍历两层所有的数据，同一个key只出现一次
+reverse: true = 先L2再L1，都是从旧到新 false = 反过来
+*/
+func (cache *Tiered) Iterator(reverse bool) *Iterator {
+	return newSliceIterator(cache.pairs(reverse))
+}
+
+func (cache *Tiered) Iter(reverse bool) <-chan lruPair {
+	return newSliceIterator(cache.pairs(reverse)).C
+}
+
+// L1淘汰的entry降级到L2，在L1的锁里调用
+func (cache *Tiered) demote(k, v interface{}) {
+	cache.l2.Add(k, v)
+}
+
+func (cache *Tiered) pairs(reverse bool) []lruPair {
+	cache.Lock()
+	defer cache.Unlock()
+	l1 := make([]lruPair, 0, cache.l1.Size())
+	inL1 := make(map[lruKey]struct{}, cache.l1.Size())
+	for p := range cache.l1.Iter(true) {
+		l1 = append(l1, p)
+		inL1[p.k] = struct{}{}
+	}
+	pairs := make([]lruPair, 0, len(l1)+cache.l2.Size())
+	for p := range cache.l2.Iter(true) {
+		if _, ok := inL1[p.k]; !ok {
+			pairs = append(pairs, p)
+		}
+	}
+	pairs = append(pairs, l1...)
+	if !reverse {
+		reversePairs(pairs)
+	}
+	return pairs
+}
@@ -0,0 +1,120 @@
+package lru
+
+import "testing"
+
+func TestTiered_Inclusive(t *testing.T) {
+	l1 := NewThreadUnsafeLRUCache(2)
+	l2 := NewLRUCache(10)
+	a := NewTiered(l1, l2, Inclusive)
+
+	for i := 0; i < 5; i++ {
+		a.Add(i, i)
+	}
+	Assert(l1.Size() == 2, t)
+	Assert(l2.Size() == 5, t)
+	Assert(a.Size() == 5, t)
+
+	// L2 hit is copied into L1
+	Assert(a.Find(0) == 0, t)
+	Assert(l1.Find(0) == 0, t)
+	Assert(l2.Find(0) == 0, t)
+
+	AssertPairList([]lruPair{{1, 1}, {2, 2}, {3, 3}, {4, 4}, {0, 0}}, iterPairs(a), t)
+}
+
+func TestTiered_Exclusive(t *testing.T) {
+	l1 := NewLRUCache(2)
+	l2 := NewLRUCache(10)
+	a := NewTiered(l1, l2, Exclusive)
+
+	for i := 0; i < 5; i++ {
+		a.Add(i, i)
+	}
+	// L1 evictions are demoted to L2
+	Assert(l1.Size() == 2, t)
+	Assert(l2.Size() == 3, t)
+	Assert(a.Size() == 5, t)
+
+	// L2 hit moves to L1, L1's oldest moves down
+	Assert(a.Find(0) == 0, t)
+	Assert(l2.Find(0) == nil, t)
+	Assert(l2.Find(3) == 3, t)
+	Assert(a.Size() == 5, t)
+
+	// a new value replaces the copy in L2
+	a.Add(1, "one")
+	Assert(a.Find(1) == "one", t)
+	Assert(l2.Find(1) == nil, t)
+}
+
+func TestTiered_Remove(t *testing.T) {
+	for _, placement := range []Placement{Inclusive, Exclusive} {
+		a := NewTiered(NewLRUCache(2), NewLRUCache(10), placement)
+		for i := 0; i < 5; i++ {
+			a.Add(i, i)
+		}
+		Assert(a.Remove(0) == 0, t)
+		Assert(a.Remove(4) == 4, t)
+		Assert(a.Remove(4) == nil, t)
+		Assert(a.Find(0) == nil, t)
+		Assert(a.Find(4) == nil, t)
+		Assert(a.Size() == 3, t)
+	}
+}
+
+// two L1s in front of one shared L2
+func TestTiered_SharedL2(t *testing.T) {
+	l2 := NewLRUCache(100)
+	a := NewTiered(NewLRUCache(2), l2, Inclusive)
+	b := NewTiered(NewLRUCache(2), l2, Inclusive)
+
+	a.Add("k", "v")
+	Assert(b.Find("k") == "v", t)
+	b.Remove("k")
+	Assert(l2.Find("k") == nil, t)
+}
+
+func TestTiered_Iterator(t *testing.T) {
+	a := NewTiered(NewLRUCache(2), NewLRUCache(10), Exclusive)
+	for i := 0; i < 4; i++ {
+		a.Add(i, i)
+	}
+	iterator := a.Iterator(false)
+	result := make([]lruPair, 0, 4)
+	for p := range iterator.C {
+		result = append(result, p)
+		if p.k.(int) == 2 {
+			iterator.Stop()
+		}
+	}
+	AssertPairList([]lruPair{{3, 3}, {2, 2}}, result, t)
+}
+
+// Create keeps the larger L2 instead of shrinking it to L1's size
+func TestTiered_Create(t *testing.T) {
+	l2 := NewLRUCache(10)
+	a := NewTiered(NewLRUCache(2), l2, Inclusive)
+	a.Add(0, 0)
+	a.Create(2)
+	Assert(a.Size() == 0, t)
+	for i := 0; i < 10; i++ {
+		a.Add(i, i)
+	}
+	Assert(l2.Size() == 10, t)
+
+	// a new L1 size scales L2 with it
+	a.Create(4)
+	for i := 0; i < 30; i++ {
+		a.Add(i, i)
+	}
+	Assert(l2.Size() == 20, t)
+
+	// an exclusive cache still demotes after a flush
+	l2 = NewLRUCache(10)
+	a = NewTiered(NewLRUCache(2), l2, Exclusive)
+	a.Create(2)
+	for i := 0; i < 5; i++ {
+		a.Add(i, i)
+	}
+	Assert(l2.Find(2) == 2, t)
+}
@@ -0,0 +1,77 @@
+package lru
+
+import "iter"
+
+/**
+某一时刻缓存内容的只读拷贝
+拿快照时在读锁里把整个链表拷贝成一个slice，cost: O(n)，写要等拷贝完，和Iterator一样
+之后遍历不持有任何锁，写不会被慢的读者挡住
+不是写时复制(copy-on-write)，也没有版本化的node：node会被空闲链表回收复用，没法保留旧版本，所以没有做
+和Iterator的区别只是可以多次遍历，不需要channel
+每次都是新的拷贝，不会复用，也不会让已经淘汰的value一直活着
+*/
+type Snapshot struct {
+	pairs []lruPair // 从旧到新(head.next -> tail.prev)
+}
+
+// 快照里entry的数量
+func (s *Snapshot) Len() int {
+	return len(s.pairs)
+}
+
+/**
+遍历快照，顺序和Iterator(reverse)一样，fn返回false时停止
+fn里可以调用缓存
+*/
+func (s *Snapshot) Range(reverse bool, fn func(k, v interface{}) bool) {
+	if reverse {
+		for _, p := range s.pairs {
+			if !fn(p.k, p.v) {
+				return
+			}
+		}
+	} else {
+		for i := len(s.pairs) - 1; i >= 0; i-- {
+			if !fn(s.pairs[i].k, s.pairs[i].v) {
+				return
+			}
+		}
+	}
+}
+
+// 从新到旧
+func (s *Snapshot) All() iter.Seq2[interface{}, interface{}] {
+	return func(yield func(k, v interface{}) bool) {
+		s.Range(false, yield)
+	}
+}
+
+// 从旧到新
+func (s *Snapshot) Backward() iter.Seq2[interface{}, interface{}] {
+	return func(yield func(k, v interface{}) bool) {
+		s.Range(true, yield)
+	}
+}
+
+func (s *Snapshot) Keys() iter.Seq[interface{}] {
+	return keysOf(s.All())
+}
+
+func (s *Snapshot) Values() iter.Seq[interface{}] {
+	return valuesOf(s.All())
+}
+
+// 拷贝一份快照，cost: O(n)
+func (cache *threadUnsafeLRU) Snapshot() *Snapshot {
+	return &Snapshot{pairs: cache.sortedPairs(true)}
+}
+
+/**
+拷贝一份快照，cost: O(n)
+只在拷贝的时候持有读锁
+*/
+func (cache *threadSafeLRU) Snapshot() *Snapshot {
+	cache.RLock()
+	defer cache.RUnlock()
+	return cache.c.Snapshot()
+}
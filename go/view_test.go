@@ -0,0 +1,81 @@
+package lru
+
+import (
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	for _, a := range []LRUCache{NewLRUCache(4), NewThreadUnsafeLRUCache(4)} {
+		r := a.(Ranger)
+		Assert(r.Snapshot().Len() == 0, t)
+		for i := 1; i <= 5; i++ {
+			a.Add(i, i*10)
+		}
+		a.Find(3)
+		s := r.Snapshot()
+		Assert(s.Len() == 4, t)
+		Assert(slices.Equal(slices.Collect(s.Keys()), []interface{}{3, 5, 4, 2}), t)
+		Assert(slices.Equal(slices.Collect(s.Values()), []interface{}{30, 50, 40, 20}), t)
+		var got []lruPair
+		for k, v := range s.Backward() {
+			got = append(got, lruPair{k, v})
+		}
+		AssertPairList([]lruPair{{2, 20}, {4, 40}, {5, 50}, {3, 30}}, got, t)
+
+		// later writes do not show up, and the body may write
+		for k := range s.All() {
+			a.Remove(k)
+			a.Add(k.(int)+100, 0)
+		}
+		Assert(slices.Equal(slices.Collect(s.Keys()), []interface{}{3, 5, 4, 2}), t)
+		s2 := r.Snapshot()
+		Assert(slices.Equal(slices.Collect(s2.Keys()), []interface{}{102, 104, 105, 103}), t)
+
+		// a Find moves an entry, only a new snapshot sees it
+		a.Find(105)
+		Assert(slices.Equal(slices.Collect(s2.Keys()), []interface{}{102, 104, 105, 103}), t)
+		Assert(slices.Equal(slices.Collect(r.Snapshot().Keys()), []interface{}{105, 102, 104, 103}), t)
+	}
+}
+
+// a slow reader of a snapshot does not block writers
+func TestThreadSafeLRU_Snapshot_SlowReader(t *testing.T) {
+	a := NewLRUCache(CAP)
+	for i := 0; i < CAP; i++ {
+		a.Add(i, i)
+	}
+	reading := make(chan struct{})
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		it := a.Iterator(true)
+		<-it.C
+		close(reading)
+		<-release
+		n := 1
+		for range it.C {
+			n++
+		}
+		Assert(n == CAP, t)
+	}()
+	<-reading
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < N; i++ {
+			a.Add(CAP+i, i)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writers blocked by a reader")
+	}
+	close(release)
+	wg.Wait()
+}
@@ -0,0 +1,657 @@
+package lru
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	walFile      = "wal"      // 日志文件名
+	snapshotFile = "snapshot" // 快照文件名
+
+	walAdd    byte = 1 // Add(k, v)
+	walRemove byte = 2 // Remove(k)
+	walTouch  byte = 3 // Find(k) 命中，只改变顺序
+	walReset  byte = 4 // Create(cap)，key是cap
+
+	defaultCompactEvery = 10000
+)
+
+var (
+	ErrNotSnapshotter = errors.New("lru: cache does not support snapshots")
+	ErrWALClosed      = errors.New("lru: wal is closed")
+)
+
+// 带预写日志(WAL)的缓存
+// 进程被kill之后重新打开，内容和顺序都和之前一样
+type WALCache interface {
+	LRUCache
+
+	// wait until every logged operation is on disk, return the first write error
+	Sync() error
+
+	// write a snapshot and drop the log records it covers
+	// Add and Remove go on while the snapshot is written
+	Compact() error
+
+	// flush, stop the background flusher and close the log
+	// after Close, Add, Remove and Create are rejected and leave the cache unchanged,
+	// Sync returns ErrWALClosed
+	Close() error
+}
+
+type WALOptions struct {
+	// codec for keys and values in the log and the snapshot, default is GobCodec
+	Codec Codec
+
+	// how long the flusher waits to gather more records before one fsync
+	// 0 means fsync as soon as there is something to write
+	SyncInterval time.Duration
+
+	// compact into a snapshot after this many records, default is 10000
+	CompactEvery int
+}
+
+/**
+一批等待fsync的记录
+写完后关闭done，err是这批的写入结果
+*/
+type walBatch struct {
+	done chan struct{}
+	err  error
+}
+
+/**
+WAL 缓存
+每次Add和Remove都先作用到cache，再把记录追加到缓冲区，由后台协程批量写入并fsync(group commit)
+Add和Remove会等到自己的记录落盘后才返回
+Find命中也会记一条touch，保证恢复后顺序一样，但不等待落盘
+记录太多时把cache的快照写到磁盘，然后去掉日志里快照已经包含的记录
+
+日志记录格式 (大端)
+	length   uint32  后面payload的长度
+	checksum uint32  payload的crc32
+	payload  op byte, seq uvarint, keylen uvarint, key, [valuelen uvarint, value]
+
+快照文件格式
+	seq      uint64  快照包含的最后一条记录的seq
+	data             Snapshotter.SaveTo写的内容
+重放时跳过seq不大于快照seq的记录，所以写完快照、清理日志之前崩溃也不会重复执行
+*/
+type walCache struct {
+	cache    LRUCache
+	dir      string
+	codec    Codec
+	interval time.Duration
+	every    int
+
+	mu         sync.Mutex // 保证cache的操作顺序和日志的顺序一样
+	buf        []byte     // 还没写入的记录
+	batch      *walBatch  // 等待buf落盘的批次
+	writing    *walBatch  // flusher正在写的批次，没有时为nil
+	seq        uint64     // 最后一条记录的seq
+	records    int        // 日志里和buf里的记录数
+	compacting bool       // 有一个自动compact在进行
+	err        error      // 第一个写入错误
+	closed     bool
+
+	fileMu    sync.Mutex // 写日志文件和替换日志文件互斥，先于mu加锁
+	file      *os.File
+	compactMu sync.Mutex // 同时只做一个compact
+
+	kick chan struct{} // 通知flusher有新的记录
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+/**
+打开WAL
+dir: 存放日志和快照的目录，不存在会创建
+cache: 被包装的缓存，必须实现Snapshotter (NewLRUCache返回的就可以)
+先恢复快照，再重放日志，日志末尾写了一半的记录会被截掉
+*/
+func OpenWAL(dir string, cache LRUCache, opts *WALOptions) (WALCache, error) {
+	s, ok := cache.(Snapshotter)
+	if !ok {
+		return nil, ErrNotSnapshotter
+	}
+	if opts == nil {
+		opts = &WALOptions{}
+	}
+	w := &walCache{
+		cache:    cache,
+		dir:      dir,
+		codec:    opts.Codec,
+		interval: opts.SyncInterval,
+		every:    opts.CompactEvery,
+		batch:    &walBatch{done: make(chan struct{})},
+		kick:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+	}
+	if w.codec == nil {
+		w.codec = GobCodec
+	}
+	if w.every <= 0 {
+		w.every = defaultCompactEvery
+	}
+	s.SetCodec(w.codec)
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if f, err := os.Open(filepath.Join(dir, snapshotFile)); err == nil {
+		err = w.load(s, f)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	end, err := w.replay(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	// 截掉写了一半的记录
+	if err := f.Truncate(end); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	w.file = f
+
+	w.wg.Add(1)
+	go w.flusher()
+	return w, nil
+}
+
+func (w *walCache) Create(cap int) {
+	w.mu.Lock()
+	if w.rejectLocked() {
+		w.mu.Unlock()
+		return
+	}
+	w.cache.Create(cap)
+	b := w.appendLocked(walReset, cap, nil)
+	w.mu.Unlock()
+	w.wait(b)
+}
+
+func (w *walCache) Add(k lruKey, v lruValue) {
+	w.mu.Lock()
+	if w.rejectLocked() {
+		w.mu.Unlock()
+		return
+	}
+	w.cache.Add(k, v)
+	b := w.appendLocked(walAdd, k, v)
+	w.mu.Unlock()
+	w.wait(b)
+}
+
+func (w *walCache) Find(k lruKey) lruValue {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	v := w.cache.Find(k)
+	// 关闭后只读内存，不再记录访问
+	if v != nil && !w.closed {
+		w.appendLocked(walTouch, k, nil)
+	}
+	return v
+}
+
+func (w *walCache) Size() int {
+	return w.cache.Size()
+}
+
+func (w *walCache) Remove(k lruKey) lruValue {
+	w.mu.Lock()
+	if w.rejectLocked() {
+		w.mu.Unlock()
+		return nil
+	}
+	v := w.cache.Remove(k)
+	var b *walBatch
+	if v != nil {
+		b = w.appendLocked(walRemove, k, nil)
+	}
+	w.mu.Unlock()
+	w.wait(b)
+	return v
+}
+
+func (w *walCache) Iterator(reverse bool) *Iterator {
+	return w.cache.Iterator(reverse)
+}
+
+func (w *walCache) Iter(reverse bool) <-chan lruPair {
+	return w.cache.Iter(reverse)
+}
+
+/**
+等待之前所有的记录落盘
+包括flusher已经取走、正在写的批次，和还在缓冲区里的批次
+*/
+func (w *walCache) Sync() error {
+	w.mu.Lock()
+	writing, b := w.writing, w.batch
+	if len(w.buf) == 0 {
+		b = nil
+	}
+	w.mu.Unlock()
+	for _, wb := range []*walBatch{writing, b} {
+		if wb == nil {
+			continue
+		}
+		w.kickFlusher()
+		<-wb.done
+		if wb.err != nil {
+			return wb.err
+		}
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *walCache) Compact() error {
+	return w.compactNow()
+}
+
+func (w *walCache) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrWALClosed
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	close(w.stop)
+	w.wg.Wait()
+	// 等正在进行的Compact用完日志文件
+	w.compactMu.Lock()
+	defer w.compactMu.Unlock()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	err := w.err
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// 关闭之后拒绝写操作，记下ErrWALClosed
+func (w *walCache) rejectLocked() bool {
+	if w.closed && w.err == nil {
+		w.err = ErrWALClosed
+	}
+	return w.closed
+}
+
+/**
+追加一条记录到缓冲区
+return: 这条记录所在的批次
+*/
+func (w *walCache) appendLocked(op byte, k lruKey, v lruValue) *walBatch {
+	if w.closed {
+		if w.err == nil {
+			w.err = ErrWALClosed
+		}
+		return nil
+	}
+	payload := binary.AppendUvarint([]byte{op}, w.seq+1)
+	var err error
+	payload, err = w.appendItem(payload, k)
+	if err == nil && op == walAdd {
+		payload, err = w.appendItem(payload, v)
+	}
+	if err != nil {
+		if w.err == nil {
+			w.err = err
+		}
+		return nil
+	}
+	w.buf = binary.BigEndian.AppendUint32(w.buf, uint32(len(payload)))
+	w.buf = binary.BigEndian.AppendUint32(w.buf, crc32.ChecksumIEEE(payload))
+	w.buf = append(w.buf, payload...)
+	w.seq++
+	w.records++
+	w.kickFlusher()
+	return w.batch
+}
+
+func (w *walCache) appendItem(buf []byte, v interface{}) ([]byte, error) {
+	data, err := w.codec.Marshal(v)
+	if err != nil {
+		return buf, err
+	}
+	buf = binary.AppendUvarint(buf, uint64(len(data)))
+	return append(buf, data...), nil
+}
+
+// 等待批次落盘
+func (w *walCache) wait(b *walBatch) {
+	if b != nil {
+		<-b.done
+	}
+}
+
+func (w *walCache) kickFlusher() {
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+}
+
+/**
+后台写日志的协程
+每次把缓冲区里所有的记录一起写入，一次fsync
+*/
+func (w *walCache) flusher() {
+	defer w.wg.Done()
+	for {
+		select {
+		case <-w.kick:
+		case <-w.stop:
+			w.flush()
+			return
+		}
+		if w.interval > 0 {
+			// 等一会儿，让更多的记录进到同一批
+			select {
+			case <-time.After(w.interval):
+			case <-w.stop:
+			}
+		}
+		w.flush()
+	}
+}
+
+func (w *walCache) flush() {
+	w.fileMu.Lock()
+	w.mu.Lock()
+	if len(w.buf) == 0 {
+		w.mu.Unlock()
+		w.fileMu.Unlock()
+		return
+	}
+	data := w.buf
+	b := w.batch
+	w.buf = nil
+	w.batch = &walBatch{done: make(chan struct{})}
+	w.writing = b
+	w.mu.Unlock()
+
+	_, err := w.file.Write(data)
+	if err == nil {
+		err = w.file.Sync()
+	}
+	w.fileMu.Unlock()
+	b.err = err
+	close(b.done)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writing = nil
+	if err != nil && w.err == nil {
+		w.err = err
+	}
+	if w.records >= w.every && !w.compacting {
+		// 在另一个协程里做，flusher继续写日志
+		w.compacting = true
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			w.compactNow()
+			w.mu.Lock()
+			w.compacting = false
+			w.mu.Unlock()
+		}()
+	}
+}
+
+/**
+把cache的快照写到磁盘，然后去掉日志里快照已经包含的记录
+1. 持有锁，记下最后一条记录的seq和它在日志里的结尾位置，把快照编码到内存
+2. 不持有锁，写临时文件、fsync、rename，这期间Add和Remove照常进行
+3. 持有fileMu，去掉日志里seq不大于快照的部分
+   日志里还有之后的记录时，把它们复制到新文件再rename替换，否则直接清空
+   这些记录还在缓冲区里时，直接从缓冲区去掉，缓冲区空了等待的批次也直接完成
+任何一步崩溃，重放时都会跳过快照已经包含的记录
+*/
+func (w *walCache) compactNow() error {
+	w.compactMu.Lock()
+	defer w.compactMu.Unlock()
+
+	var snap bytes.Buffer
+	w.fileMu.Lock()
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		w.fileMu.Unlock()
+		return ErrWALClosed
+	}
+	seq, records := w.seq, w.records
+	end, err := w.file.Seek(0, io.SeekCurrent)
+	end += int64(len(w.buf))
+	if err == nil {
+		snap.Write(binary.BigEndian.AppendUint64(nil, seq))
+		err = w.cache.(Snapshotter).SaveTo(&snap)
+	}
+	w.mu.Unlock()
+	w.fileMu.Unlock()
+	if err != nil {
+		return w.fail(err)
+	}
+
+	if err := w.writeSnapshot(snap.Bytes()); err != nil {
+		return w.fail(err)
+	}
+
+	w.fileMu.Lock()
+	defer w.fileMu.Unlock()
+	size, err := w.file.Seek(0, io.SeekCurrent)
+	if err == nil {
+		if size > end {
+			err = w.rewriteLog(end, size)
+		} else if err = w.file.Truncate(0); err == nil {
+			_, err = w.file.Seek(0, io.SeekStart)
+		}
+	}
+	if err != nil {
+		return w.fail(err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if end > size {
+		w.buf = w.buf[end-size:]
+		if len(w.buf) == 0 {
+			close(w.batch.done)
+			w.batch = &walBatch{done: make(chan struct{})}
+		}
+	}
+	w.records -= records
+	return nil
+}
+
+// 先写临时文件再rename，中途失败也不会破坏旧的快照
+func (w *walCache) writeSnapshot(data []byte) error {
+	tmp := filepath.Join(w.dir, snapshotFile+".tmp")
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(w.dir, snapshotFile))
+	}
+	if err == nil {
+		err = syncDir(w.dir)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// 把日志[from, to)的记录复制到新文件，rename替换旧的日志
+func (w *walCache) rewriteLog(from, to int64) error {
+	tmp := filepath.Join(w.dir, walFile+".tmp")
+	f, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, io.NewSectionReader(w.file, from, to-from))
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmp, filepath.Join(w.dir, walFile))
+	}
+	if err == nil {
+		err = syncDir(w.dir)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	w.file.Close()
+	w.file = f
+	return nil
+}
+
+func (w *walCache) fail(err error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err == nil {
+		w.err = err
+	}
+	return err
+}
+
+// 读快照文件，记下快照的seq
+func (w *walCache) load(s Snapshotter, f io.Reader) error {
+	head := make([]byte, 8)
+	if _, err := io.ReadFull(f, head); err != nil {
+		return ErrBadSnapshot
+	}
+	w.seq = binary.BigEndian.Uint64(head)
+	return s.LoadFrom(f)
+}
+
+/**
+重放日志
+return: 最后一条完整记录的结尾位置
+*/
+func (w *walCache) replay(f *os.File) (int64, error) {
+	r := bufio.NewReader(f)
+	var end int64
+	head := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, head); err != nil {
+			return end, nil
+		}
+		n := binary.BigEndian.Uint32(head)
+		sum := binary.BigEndian.Uint32(head[4:])
+		if n > maxSnapshotItem {
+			return end, nil
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return end, nil
+		}
+		if crc32.ChecksumIEEE(payload) != sum {
+			return end, nil
+		}
+		if len(payload) == 0 {
+			return end, ErrBadEncoding
+		}
+		seq, l := binary.Uvarint(payload[1:])
+		if l <= 0 {
+			return end, ErrBadEncoding
+		}
+		// 快照已经包含了这条记录
+		if seq > w.seq {
+			if err := w.apply(payload[0], payload[1+l:]); err != nil {
+				return end, err
+			}
+			w.seq = seq
+		}
+		end += 8 + int64(n)
+		w.records++
+	}
+}
+
+func (w *walCache) apply(op byte, data []byte) error {
+	item := func() (interface{}, error) {
+		n, l := binary.Uvarint(data)
+		if l <= 0 || uint64(len(data)-l) < n {
+			return nil, ErrBadEncoding
+		}
+		b := data[l : l+int(n)]
+		data = data[l+int(n):]
+		return w.codec.Unmarshal(b)
+	}
+	k, err := item()
+	if err != nil {
+		return err
+	}
+	switch op {
+	case walAdd:
+		v, err := item()
+		if err != nil {
+			return err
+		}
+		w.cache.Add(k, v)
+	case walRemove:
+		w.cache.Remove(k)
+	case walTouch:
+		w.cache.Find(k)
+	case walReset:
+		cap, ok := k.(int)
+		if !ok {
+			return ErrBadEncoding
+		}
+		w.cache.Create(cap)
+	default:
+		return ErrBadEncoding
+	}
+	return nil
+}
+
+// rename之后fsync目录，保证rename落盘
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
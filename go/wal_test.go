@@ -0,0 +1,204 @@
+package lru
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openWAL(t *testing.T, dir string, cap int, opts *WALOptions) WALCache {
+	w, err := OpenWAL(dir, NewLRUCache(cap), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWAL_Replay(t *testing.T) {
+	dir := t.TempDir()
+	w := openWAL(t, dir, 10, nil)
+	for i := 0; i < 5; i++ {
+		w.Add(i, i)
+	}
+	w.Remove(3)
+	w.Find(0) // 0 becomes the most recent
+	Assert(w.Sync() == nil, t)
+	Assert(w.Close() == nil, t)
+
+	w = openWAL(t, dir, 10, nil)
+	defer w.Close()
+	AssertPairList([]lruPair{{1, 1}, {2, 2}, {4, 4}, {0, 0}}, iterPairs(w), t)
+}
+
+// a process killed without Close still has every acknowledged Add
+func TestWAL_Crash(t *testing.T) {
+	dir := t.TempDir()
+	w := openWAL(t, dir, 10, &WALOptions{Codec: BinaryCodec})
+	w.Add("a", "1")
+	w.Add("b", "2")
+
+	// simulate a torn write at the end of the log
+	f, err := os.OpenFile(filepath.Join(dir, walFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 0, 9, 1, 2})
+	f.Close()
+
+	w2 := openWAL(t, dir, 10, &WALOptions{Codec: BinaryCodec})
+	AssertPairList([]lruPair{{"a", "1"}, {"b", "2"}}, iterPairs(w2), t)
+	w2.Add("c", "3")
+	w2.Close()
+	w.Close()
+
+	w3 := openWAL(t, dir, 10, &WALOptions{Codec: BinaryCodec})
+	defer w3.Close()
+	AssertPairList([]lruPair{{"a", "1"}, {"b", "2"}, {"c", "3"}}, iterPairs(w3), t)
+}
+
+func TestWAL_Compact(t *testing.T) {
+	dir := t.TempDir()
+	w := openWAL(t, dir, 5, &WALOptions{CompactEvery: 4})
+	for i := 0; i < 10; i++ {
+		w.Add(i, i)
+	}
+	Assert(w.Sync() == nil, t)
+	Assert(w.Compact() == nil, t)
+
+	info, err := os.Stat(filepath.Join(dir, walFile))
+	Assert(err == nil && info.Size() == 0, t)
+	_, err = os.Stat(filepath.Join(dir, snapshotFile))
+	Assert(err == nil, t)
+
+	w.Add(10, 10)
+	w.Create(3) // reset is logged too
+	w.Add(11, 11)
+	Assert(w.Close() == nil, t)
+	Assert(w.Compact() == ErrWALClosed, t)
+
+	w = openWAL(t, dir, 5, nil)
+	defer w.Close()
+	AssertPairList([]lruPair{{11, 11}}, iterPairs(w), t)
+}
+
+// records already in the snapshot are not replayed again,
+// as after a crash between writing the snapshot and dropping the log
+func TestWAL_CompactCrash(t *testing.T) {
+	dir := t.TempDir()
+	w := openWAL(t, dir, 10, nil)
+	w.Add(1, "old")
+	Assert(w.Sync() == nil, t)
+	stale, err := os.ReadFile(filepath.Join(dir, walFile))
+	Assert(err == nil && len(stale) > 0, t)
+	w.Add(1, "new")
+	Assert(w.Compact() == nil, t)
+	w.Add(2, 2)
+	Assert(w.Close() == nil, t)
+
+	// put the dropped records back in front of the newer ones
+	tail, err := os.ReadFile(filepath.Join(dir, walFile))
+	Assert(err == nil, t)
+	Assert(os.WriteFile(filepath.Join(dir, walFile), append(stale, tail...), 0644) == nil, t)
+
+	w = openWAL(t, dir, 10, nil)
+	defer w.Close()
+	AssertPairList([]lruPair{{1, "new"}, {2, 2}}, iterPairs(w), t)
+}
+
+// writers go on while compactions run, nothing is lost or replayed twice
+func TestWAL_CompactConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	w := openWAL(t, dir, 1000, &WALOptions{CompactEvery: 16})
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	for g := 0; g < 4; g++ {
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				w.Add(g*100+i, i)
+			}
+		}(g)
+	}
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10; i++ {
+			Assert(w.Compact() == nil, t)
+		}
+	}()
+	wg.Wait()
+	Assert(w.Close() == nil, t)
+
+	w = openWAL(t, dir, 1000, nil)
+	defer w.Close()
+	Assert(w.Size() == 400, t)
+	for k := 0; k < 400; k++ {
+		Assert(w.Find(k) == k%100, t)
+	}
+}
+
+func TestWAL_GroupCommit(t *testing.T) {
+	dir := t.TempDir()
+	w := openWAL(t, dir, 1000, &WALOptions{SyncInterval: time.Millisecond})
+
+	var wg sync.WaitGroup
+	wg.Add(100)
+	for i := 0; i < 100; i++ {
+		go func(i int) {
+			w.Add(i, i)
+			wg.Done()
+		}(i)
+	}
+	wg.Wait()
+	Assert(w.Size() == 100, t)
+	Assert(w.Close() == nil, t)
+
+	w = openWAL(t, dir, 1000, nil)
+	defer w.Close()
+	Assert(w.Size() == 100, t)
+	// the replayed order matches the order the writers were serialized in
+	for i := 0; i < 100; i++ {
+		Assert(w.Find(i) == i, t)
+	}
+}
+
+func TestWAL_NotSnapshotter(t *testing.T) {
+	_, err := OpenWAL(t.TempDir(), NewGDSCache(10), nil)
+	Assert(err == ErrNotSnapshotter, t)
+}
+
+// Sync also waits for the batch the flusher has already taken
+func TestWAL_SyncInFlight(t *testing.T) {
+	w := openWAL(t, t.TempDir(), 10, nil)
+	defer w.Close()
+	wc := w.(*walCache)
+
+	inflight := &walBatch{done: make(chan struct{})}
+	wc.mu.Lock()
+	wc.writing = inflight
+	wc.mu.Unlock()
+
+	synced := make(chan error)
+	go func() { synced <- w.Sync() }()
+	select {
+	case <-synced:
+		t.Fatal("Sync returned before the in-flight batch was written")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(inflight.done)
+	Assert(<-synced == nil, t)
+}
+
+// writes after Close do not change the cache
+func TestWAL_AfterClose(t *testing.T) {
+	w := openWAL(t, t.TempDir(), 10, nil)
+	w.Add(1, 1)
+	Assert(w.Close() == nil, t)
+	w.Add(2, 2)
+	Assert(w.Remove(1) == nil, t)
+	w.Create(10)
+	Assert(w.Size() == 1 && w.Find(1) == 1 && w.Find(2) == nil, t)
+	Assert(w.Sync() == ErrWALClosed, t)
+}